@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// busyUtil is the share of an interface's capacity above which its
+// utilisation is highlighted.
+const busyUtil = 0.9
+
+// parseIfaceMax parses an -iface-max list such as "eth0=1Gb,tun0=50Mb"
+// into capacities in bytes per second, by interface name.
+func parseIfaceMax(s string) (map[string]float64, error) {
+	capacity := make(map[string]float64)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%q: want interface=rate", item)
+		}
+		bps, err := parseCapacity(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		capacity[name] = bps
+	}
+	return capacity, nil
+}
+
+// parseCapacity parses a link rate such as "1Gb", "50Mb/s" or "12.5MB"
+// into bytes per second. A lower-case b means bits and an upper-case B
+// bytes; the k, M and G prefixes are 1000-based, as link speeds are.
+func parseCapacity(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	num := strings.TrimSuffix(strings.TrimSuffix(s, "/s"), "ps")
+	perByte := 0.0
+	switch {
+	case strings.HasSuffix(num, "b"):
+		perByte = 8
+	case strings.HasSuffix(num, "B"):
+		perByte = 1
+	default:
+		return 0, fmt.Errorf("rate %q needs a unit such as Mb (bits) or MB (bytes)", s)
+	}
+	num = num[:len(num)-1]
+	multiplier := 1.0
+	if n := len(num); n > 0 {
+		if m, ok := map[byte]float64{'k': 1e3, 'K': 1e3, 'm': 1e6, 'M': 1e6, 'g': 1e9, 'G': 1e9, 't': 1e12, 'T': 1e12}[num[n-1]]; ok {
+			num, multiplier = num[:n-1], m
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if err != nil || !(n > 0) {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	return n * multiplier / perByte, nil
+}
+
+// utilisation renders the latest rates in h as shares of capacity, e.g.
+// "↑ 12% ↓ 3% of 1.0 Gb/s", highlighting a direction above busyUtil.
+func (m Model) utilisation(h *rateHistory, capacity float64) string {
+	share := func(values []float64) string {
+		if len(values) == 0 {
+			return "--"
+		}
+		u := values[len(values)-1] / capacity
+		s := fmt.Sprintf("%.0f%%", u*100)
+		if u >= busyUtil {
+			s = eventDownStyle.Render(s)
+		}
+		return s
+	}
+	return fmt.Sprintf("↑ %s ↓ %s of %s", share(h.Sent), share(h.Recv), m.formatRate(capacity))
+}
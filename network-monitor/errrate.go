@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"clifs/shared/rate"
+	"clifs/shared/ui"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// errTrendLen is how many recent samples decide whether an interface's
+// error rate is climbing: the newer half is compared with the older.
+const errTrendLen = 10
+
+// errRisingStyle marks interfaces whose error rate is climbing; set by
+// applyTheme.
+var errRisingStyle lipgloss.Style
+
+// recordErrors derives each interface's rate of errors and drops, in and
+// out together, from the change in its counters since the previous sample,
+// and adds it to the interface's error history. A NIC that is starting to
+// flap shows up in these rates well before its cumulative counts stand out.
+func (m *Model) recordErrors(now time.Time) {
+	if m.errRates == nil {
+		m.errRates = &rate.Tracker{CounterBits: *counterBits}
+		m.errHistory = make(map[string][]float64)
+	}
+	readings := make(map[string][]uint64, len(m.networkStats))
+	for _, stat := range m.networkStats {
+		readings[stat.Name] = []uint64{stat.Errin, stat.Errout, stat.Dropin, stat.Dropout}
+	}
+	for name, r := range m.errRates.Update(now, readings) {
+		m.errHistory[name] = trimHistory(append(m.errHistory[name], r[0]+r[1]+r[2]+r[3]))
+	}
+}
+
+// errorsRising reports whether name's error rate is climbing: errors in
+// the newer half of its recent samples, and more of them than in the older
+// half.
+func (m Model) errorsRising(name string) bool {
+	h := m.errHistory[name]
+	if len(h) < 2 {
+		return false
+	}
+	recent := h[max(len(h)-errTrendLen, 0):]
+	half := len(recent) / 2
+	var older, newer float64
+	for _, v := range recent[:half] {
+		older += v
+	}
+	for _, v := range recent[half:] {
+		newer += v
+	}
+	// Compare averages, as the newer half is the longer one when odd.
+	return newer > 0 && newer/float64(len(recent)-half) > older/float64(half)
+}
+
+// errorsLine renders an interface's error rate and its history, or "" if
+// the interface has had no errors or drops in its history, which is
+// usually.
+func (m Model) errorsLine(name string, width int) string {
+	h := m.errHistory[name]
+	seen := false
+	for _, v := range h {
+		seen = seen || v > 0
+	}
+	if !seen {
+		return ""
+	}
+	line := fmt.Sprintf("   errors %s %.1f/s", ui.Sparkline(h, width), h[len(h)-1])
+	if m.errorsRising(name) {
+		return errRisingStyle.Render(line) + "\n"
+	}
+	return mutedStyle.Render(line) + "\n"
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"clifs/shared/ui"
+)
+
+// graphHeight is the height of the bandwidth graph in rows.
+const graphHeight = 6
+
+// graphLabelWidth is the space reserved right of the graph for labels.
+const graphLabelWidth = 18
+
+// brailleDots maps a dot position within a braille cell, [column][row]
+// with row 0 at the top, to its bit in the Unicode braille block.
+var brailleDots = [2][4]rune{
+	{0x01, 0x02, 0x04, 0x40},
+	{0x08, 0x10, 0x20, 0x80},
+}
+
+// renderGraph plots the sent and recv series as braille lines on a shared
+// axis scaled to the peak of either, width columns wide including labels.
+// The current and peak values are labelled at the right edge, formatted
+// with rate.
+func renderGraph(sent, recv []float64, width, height int, rate func(float64) string) string {
+	cols := width - graphLabelWidth
+	if cols < 10 {
+		cols = 10
+	}
+
+	var peak float64
+	for _, series := range [][]float64{sent, recv} {
+		for _, v := range series {
+			if v > peak {
+				peak = v
+			}
+		}
+	}
+
+	sentCells := plotSeries(sent, cols, height, peak)
+	recvCells := plotSeries(recv, cols, height, peak)
+
+	labels := make([]string, height)
+	labels[0] = "peak " + rate(peak)
+	if height > 2 {
+		labels[1] = graphSentStyle.Render("↑ " + rate(last(sent)))
+		labels[2] = graphRecvStyle.Render("↓ " + rate(last(recv)))
+	}
+
+	var b strings.Builder
+	for row := 0; row < height; row++ {
+		for col := 0; col < cols; col++ {
+			s, r := sentCells[row][col], recvCells[row][col]
+			cell := string(0x2800 + (s | r))
+			switch {
+			case s != 0 && r != 0:
+				cell = graphBothStyle.Render(cell)
+			case s != 0:
+				cell = graphSentStyle.Render(cell)
+			case r != 0:
+				cell = graphRecvStyle.Render(cell)
+			}
+			b.WriteString(cell)
+		}
+		fmt.Fprintf(&b, " %s\n", labels[row])
+	}
+	return b.String()
+}
+
+// plotSeries rasterises values into braille dot masks, stretching the
+// series across the full width.
+func plotSeries(values []float64, cols, rows int, peak float64) [][]rune {
+	cells := make([][]rune, rows)
+	for i := range cells {
+		cells[i] = make([]rune, cols)
+	}
+	if len(values) == 0 {
+		return cells
+	}
+
+	dotsX, dotsY := cols*2, rows*4
+	values = ui.Downsample(values, dotsX)
+	for x := 0; x < dotsX; x++ {
+		v := values[x*len(values)/dotsX]
+		y := 0
+		if peak > 0 {
+			y = int(v / peak * float64(dotsY-1))
+		}
+		// y counts up from the bottom; cells count down from the top.
+		top := dotsY - 1 - y
+		cells[top/4][x/2] |= brailleDots[x%2][top%4]
+	}
+	return cells
+}
+
+// last returns the final value of a series, or zero if it is empty.
+func last(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	return values[len(values)-1]
+}
@@ -0,0 +1,46 @@
+package main
+
+import "github.com/charmbracelet/lipgloss"
+
+// activityLen is how many recent samples an interface's activity score
+// covers, and activityDecay how much each older one counts relative to
+// the one after it.
+const (
+	activityLen   = 10
+	activityDecay = 0.7
+)
+
+// activityLevels are the total rates, in bytes per second, at or above
+// which an interface's name is drawn one step brighter.
+var activityLevels = []float64{1 << 10, 100 << 10, 10 << 20}
+
+// activityStyles colour interface names from idle to busy, one more than
+// there are activityLevels; set by applyTheme.
+var activityStyles []lipgloss.Style
+
+// activityScore is the weighted average total rate over the last
+// activityLen samples in h, the newest counting most, so an interface
+// fades over several samples as it goes quiet rather than at once.
+func activityScore(h *rateHistory) float64 {
+	var sum, weights float64
+	w := 1.0
+	for i := len(h.Sent) - 1; i >= 0 && i >= len(h.Sent)-activityLen; i-- {
+		sum += w * (h.Sent[i] + h.Recv[i])
+		weights += w
+		w *= activityDecay
+	}
+	if weights == 0 {
+		return 0
+	}
+	return sum / weights
+}
+
+// heat renders an interface name coloured by its activity score.
+func (m Model) heat(name string) string {
+	score := m.activity[name]
+	level := 0
+	for level < len(activityLevels) && score >= activityLevels[level] {
+		level++
+	}
+	return activityStyles[level].Render(name)
+}
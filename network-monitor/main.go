@@ -1,84 +1,367 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"net"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"clifs/shared/pace"
+	"clifs/shared/rate"
+	"clifs/shared/state"
+	"clifs/shared/theme"
+	"clifs/shared/ui"
+	"clifs/shared/units"
+	"clifs/shared/version"
+
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	psnet "github.com/shirou/gopsutil/net"
+	"golang.org/x/term"
 )
 
 // Model holds application state.
 type Model struct {
 	interfaces   []net.Interface
 	networkStats []psnet.IOCountersStat
-	historySent  []float64 // history for bytes sent
-	historyRecv  []float64 // history for bytes received
+	historySent  []float64 // history of the total send rate
+	historyRecv  []float64 // history of the total receive rate
 	latestSent   uint64    // new: current total bytes sent
 	latestRecv   uint64    // new: current total bytes received
-	err          error
+	ifaceErr     error     // last error listing interfaces, nil once it recovers
+	statsErr     error     // last error reading counters, nil once it recovers
+	lastErr      error     // most recent error from either fetch, kept after recovery
+	lastErrAt    time.Time
 	lastUpdate   time.Time
+	width        int
+	height       int
+
+	rates   *rate.Tracker           // turns counters into per-second rates
+	history map[string]*rateHistory // per-interface rate history
+	log     *rateLog                // rate log set by -log, nil if disabled
+
+	seenInterfaces bool // whether interfaces has been fetched at least once
+	seenStats      bool // whether networkStats has been fetched at least once
+	events         []ifaceEvent
+
+	selected int  // index of the selected interface
+	expanded bool // show details of the selected interface
+
+	primary string // interface carrying the default route, if known
+	ticks   int    // ticks since start, for less frequent lookups
+
+	pacer   *pace.Pacer // slows ticks down while the network is quiet
+	tickGen int         // generation of the pending tick; older ones are dropped
+	active  bool        // whether the latest total rate was above idleRate
+
+	rateSent, rateRecv       float64              // latest total rates, bytes per second
+	sessionSent, sessionRecv uint64               // bytes moved since start, all interfaces
+	sessionPrev              map[string][2]uint64 // previous counters, by interface
+	sessionByIface           map[string]*ifaceTotals
+	started                  time.Time // start of the session, for the summary on quit
+
+	refreshing bool          // r was pressed and the new counters have not arrived yet
+	statsTook  time.Duration // how long reading the latest counters took
+
+	bits     bool               // show rates in bits per second rather than bytes
+	capacity map[string]float64 // bytes per second, by interface, from -iface-max
+
+	smoothed    map[string]*[2]rate.EWMA // smoothed sent/received rates, by interface
+	smoothTotal [2]rate.EWMA             // smoothed total rates
+	smoothBars  bool                     // sparklines and the graph follow the smoothed rates
+
+	activity map[string]float64 // recent activity score of each interface; see activityScore
+
+	errRates   *rate.Tracker        // turns error and drop counters into rates
+	errHistory map[string][]float64 // errors and drops per second, in and out, by interface
+}
+
+// idleAfter is how long the network must stay quiet before ticks slow down.
+const idleAfter = 30 * time.Second
+
+// idleRate is the total rate, in bytes per second, below which the network
+// counts as quiet.
+const idleRate = 1024
+
+// timeLayouts maps -timefmt names to time layouts.
+var timeLayouts = map[string]string{
+	"short":   "15:04:05",
+	"rfc3339": time.RFC3339,
+	"rfc1123": time.RFC1123,
 }
 
-// TickMsg signals a tick update.
-type TickMsg time.Time
+// timeLayout is the layout chosen with -timefmt.
+var timeLayout = timeLayouts["short"]
+
+// stamp formats a timestamp for display, as chosen with -timefmt and -utc.
+func stamp(t time.Time) string {
+	if *utcFlag {
+		t = t.UTC()
+	}
+	return t.Format(timeLayout)
+}
+
+// maxEvents is the number of interface events kept in the log.
+const maxEvents = 5
+
+// toastDuration is how long a new event stays highlighted.
+const toastDuration = 10 * time.Second
+
+// ifaceEvent records an interface changing state.
+type ifaceEvent struct {
+	at   time.Time
+	name string
+	what string // "UP", "DOWN", "ADDED" or "REMOVED"
+}
+
+// String describes the event, e.g. "wlan0 went DOWN".
+func (e ifaceEvent) String() string {
+	switch e.what {
+	case "ADDED":
+		return e.name + " appeared"
+	case "REMOVED":
+		return e.name + " disappeared"
+	}
+	return e.name + " went " + e.what
+}
+
+// diffInterfaces returns the events between two interface samples,
+// matching interfaces by name.
+func diffInterfaces(prev, cur []net.Interface, now time.Time) []ifaceEvent {
+	before := make(map[string]net.Interface, len(prev))
+	for _, iface := range prev {
+		before[iface.Name] = iface
+	}
+	var events []ifaceEvent
+	for _, iface := range cur {
+		old, ok := before[iface.Name]
+		delete(before, iface.Name)
+		wasUp, isUp := old.Flags&net.FlagUp != 0, iface.Flags&net.FlagUp != 0
+		switch {
+		case !ok:
+			events = append(events, ifaceEvent{now, iface.Name, "ADDED"})
+		case wasUp && !isUp:
+			events = append(events, ifaceEvent{now, iface.Name, "DOWN"})
+		case !wasUp && isUp:
+			events = append(events, ifaceEvent{now, iface.Name, "UP"})
+		}
+	}
+	for _, iface := range prev {
+		if _, gone := before[iface.Name]; gone {
+			events = append(events, ifaceEvent{now, iface.Name, "REMOVED"})
+		}
+	}
+	return events
+}
+
+// logEvents appends events to the log, keeping the newest maxEvents.
+func (m *Model) logEvents(events []ifaceEvent) {
+	m.events = append(m.events, events...)
+	if len(m.events) > maxEvents {
+		m.events = m.events[len(m.events)-maxEvents:]
+	}
+}
+
+// rateHistory holds recent per-second rates for one interface.
+type rateHistory struct {
+	Sent []float64 `json:"sent"` // bytes sent per second
+	Recv []float64 `json:"recv"` // bytes received per second
+}
+
+// historyLen is the number of samples kept, set by -history.
+var historyLen = 20
+
+// maxHistoryLen bounds -history to keep memory use in check.
+const maxHistoryLen = 3600
+
+// trimHistory drops the oldest values beyond historyLen.
+func trimHistory(values []float64) []float64 {
+	if len(values) > historyLen {
+		return values[len(values)-historyLen:]
+	}
+	return values
+}
+
+// add appends a sample, dropping the oldest beyond historyLen.
+func (h *rateHistory) add(sent, recv float64) {
+	h.Sent = trimHistory(append(h.Sent, sent))
+	h.Recv = trimHistory(append(h.Recv, recv))
+}
+
+// ifaceInfo joins an interface with its counters by name. Either side may
+// be missing while an interface is being hotplugged, since the two are
+// fetched separately.
+type ifaceInfo struct {
+	Name  string
+	Iface *net.Interface        // nil if the interface list lacks it
+	Stats *psnet.IOCountersStat // nil if there are no counters for it
+}
+
+// joined returns the interfaces in list order, followed by any names that
+// only have counters.
+func (m Model) joined() []ifaceInfo {
+	stats := make(map[string]*psnet.IOCountersStat, len(m.networkStats))
+	for i := range m.networkStats {
+		stats[m.networkStats[i].Name] = &m.networkStats[i]
+	}
+	infos := make([]ifaceInfo, 0, len(m.interfaces))
+	for i := range m.interfaces {
+		name := m.interfaces[i].Name
+		infos = append(infos, ifaceInfo{Name: name, Iface: &m.interfaces[i], Stats: stats[name]})
+		delete(stats, name)
+	}
+	for i := range m.networkStats {
+		if st, ok := stats[m.networkStats[i].Name]; ok {
+			infos = append(infos, ifaceInfo{Name: st.Name, Stats: st})
+		}
+	}
+	return infos
+}
+
+// TickMsg signals a tick update. Ticks from an older generation are
+// ignored, so a key press can replace a slow pending tick with a fast one.
+type TickMsg struct {
+	at  time.Time
+	gen int
+}
 
 // Init initializes the program.
 func (m Model) Init() tea.Cmd {
 	// Schedule initial fetches for interfaces and network stats.
-	return tea.Batch(fetchInterfaces, fetchNetworkStats, tickCmd())
+	return tea.Batch(fetchInterfaces, fetchNetworkStats, fetchPrimary, tickCmd(m.tickGen, m.pacer.Interval()))
 }
 
 // fetchInterfaces returns a message with the current network interfaces.
 func fetchInterfaces() tea.Msg {
-	interfaces, err := net.Interfaces()
+	interfaces, err := listInterfaces()
 	if err != nil {
-		return errMsg{err}
+		return errMsg{source: "interfaces", err: err}
 	}
 	return interfacesMsg(interfaces)
 }
 
 // fetchNetworkStats returns a message with current network I/O counters.
 func fetchNetworkStats() tea.Msg {
-	stats, err := psnet.IOCounters(true)
+	start := time.Now()
+	stats, err := readCounters()
 	if err != nil {
-		return errMsg{err}
+		return errMsg{source: "stats", err: err}
 	}
-	return networkStatsMsg(stats)
+	now := time.Now()
+	return networkStatsMsg{at: now, took: now.Sub(start), stats: stats}
 }
 
-// tickCmd sends a TickMsg after 5 seconds.
-func tickCmd() tea.Cmd {
-	return tea.Tick(5*time.Second, func(t time.Time) tea.Msg {
-		return TickMsg(t)
+// tickCmd sends a TickMsg after interval.
+func tickCmd(gen int, interval time.Duration) tea.Cmd {
+	return tea.Tick(interval, func(t time.Time) tea.Msg {
+		return TickMsg{at: t, gen: gen}
 	})
 }
 
 type interfacesMsg []net.Interface
-type networkStatsMsg []psnet.IOCountersStat
+
+// networkStatsMsg carries counters with the time they were read, which
+// rates are computed from rather than when the message is handled.
+type networkStatsMsg struct {
+	at    time.Time
+	took  time.Duration // how long reading them took
+	stats []psnet.IOCountersStat
+}
+
+// errMsg reports a failed fetch; source is "interfaces" or "stats".
 type errMsg struct {
-	err error
+	source string
+	err    error
 }
 
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
 	case tea.KeyMsg:
+		// Any key returns to fast refreshes straight away.
+		var cmd tea.Cmd
+		if m.pacer.Interval() > m.pacer.Min {
+			m.pacer.Reset(time.Now())
+			m.tickGen++
+			cmd = tickCmd(m.tickGen, m.pacer.Interval())
+		}
 		switch msg.String() {
 		case "ctrl+c", "q":
 			return m, tea.Quit
+		case "down", "j":
+			m.selected++
+		case "up", "k":
+			m.selected--
+		case "g", "home":
+			m.selected = 0
+		case "G", "end":
+			m.selected = len(m.joined()) - 1
+		case "enter":
+			m.expanded = !m.expanded
+		case "b":
+			m.bits = !m.bits
+		case "s":
+			m.smoothBars = !m.smoothBars
+		case "r", " ":
+			// Restart the tick too, so the refresh does not stack with
+			// one that is about to fire.
+			m.tickGen++
+			m.refreshing = true
+			cmd = tea.Batch(fetchInterfaces, fetchNetworkStats, fetchPrimary, tickCmd(m.tickGen, m.pacer.Interval()))
+		case "+", "=":
+			m.pacer.Faster(time.Now())
+			m.tickGen++
+			cmd = tickCmd(m.tickGen, m.pacer.Interval())
+		case "-":
+			m.pacer.Slower(time.Now())
+			m.tickGen++
+			cmd = tickCmd(m.tickGen, m.pacer.Interval())
 		}
+		m.clampSelection()
+		return m, cmd
 	case interfacesMsg:
+		now := time.Now()
+		if m.seenInterfaces {
+			m.logEvents(diffInterfaces(m.interfaces, msg, now))
+		}
 		m.interfaces = []net.Interface(msg)
-		m.lastUpdate = time.Now()
-		return m, tickCmd()
+		m.seenInterfaces = true
+		m.ifaceErr = nil
+		m.clampSelection()
+		m.lastUpdate = now
+		return m, nil
 	case TickMsg:
+		if msg.gen != m.tickGen {
+			return m, nil // superseded by a key press
+		}
 		// On tick, fetch both interfaces and network stats.
-		return m, tea.Batch(fetchInterfaces, fetchNetworkStats, tickCmd())
+		m.ticks++
+		next := tickCmd(m.tickGen, m.pacer.Observe(msg.at, m.active))
+		if m.ticks%primaryEvery == 0 {
+			return m, tea.Batch(fetchInterfaces, fetchNetworkStats, fetchPrimary, next)
+		}
+		return m, tea.Batch(fetchInterfaces, fetchNetworkStats, next)
+	case primaryMsg:
+		m.primary = string(msg)
+		return m, nil
 	case networkStatsMsg:
-		m.networkStats = []psnet.IOCountersStat(msg)
+		m.networkStats = msg.stats
+		m.statsTook = msg.took
+		m.seenStats = true
+		m.refreshing = false
+		m.statsErr = nil
+		m.clampSelection()
+		sentRate, recvRate, ok := m.recordRates(msg.at)
+		m.recordErrors(msg.at)
 		// Compute total bytes sent/received across all interfaces.
 		var totalSent, totalRecv uint64
 		for _, stat := range m.networkStats {
@@ -87,77 +370,772 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		m.latestSent = totalSent
 		m.latestRecv = totalRecv
-		// Update history slices.
-		m.historySent = append(m.historySent, float64(totalSent))
-		m.historyRecv = append(m.historyRecv, float64(totalRecv))
-		// Limit history to latest 20 data points.
-		if len(m.historySent) > 20 {
-			m.historySent = m.historySent[1:]
-			m.historyRecv = m.historyRecv[1:]
+		m.addSession()
+		if !ok {
+			return m, nil
 		}
+		m.rateSent, m.rateRecv = sentRate, recvRate
+		m.smoothTotal[0].Add(sentRate)
+		m.smoothTotal[1].Add(recvRate)
+		m.active = sentRate+recvRate >= idleRate
+		// Update history slices.
+		m.historySent = append(m.historySent, sentRate)
+		m.historyRecv = append(m.historyRecv, recvRate)
+		// Limit history to the latest historyLen data points.
+		m.historySent = trimHistory(m.historySent)
+		m.historyRecv = trimHistory(m.historyRecv)
 		return m, nil
 	case errMsg:
-		m.err = msg.err
-		return m, tea.Quit
+		// Keep ticking so the display recovers once the fetch succeeds.
+		if msg.source == "interfaces" {
+			m.ifaceErr = msg.err
+		} else {
+			m.statsErr = msg.err
+		}
+		m.lastErr = msg.err
+		m.lastErrAt = time.Now()
+		m.refreshing = false
+		return m, nil
 	}
 	return m, nil
 }
 
+// clampSelection keeps the selection within the interface list.
+func (m *Model) clampSelection() {
+	if n := len(m.joined()); m.selected > n-1 {
+		m.selected = n - 1
+	}
+	if m.selected < 0 {
+		m.selected = 0
+	}
+}
+
+// linkSpeed returns the link speed of an interface in Mb/s as reported by
+// Linux sysfs, or "n/a" where that is unavailable.
+func linkSpeed(name string) string {
+	if remote != nil {
+		return "n/a" // sysfs here describes this machine
+	}
+	data, err := os.ReadFile(filepath.Join("/sys/class/net", name, "speed"))
+	if err != nil {
+		return "n/a"
+	}
+	speed, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || speed <= 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%d Mb/s", speed)
+}
+
+// Address kinds, in display order.
+const (
+	addrIPv4 = iota
+	addrIPv6Global
+	addrLinkLocal
+	addrLoopback
+	addrOther
+)
+
+var addrKindNames = []string{"IPv4", "IPv6 global", "link-local", "loopback", "other"}
+
+// addrKind classifies an interface address such as "fe80::1/64".
+func addrKind(addr net.Addr) int {
+	ip, _, err := net.ParseCIDR(addr.String())
+	if err != nil {
+		ip = net.ParseIP(addr.String())
+	}
+	switch {
+	case ip == nil:
+		return addrOther
+	case ip.IsLoopback():
+		return addrLoopback
+	case ip.IsLinkLocalUnicast():
+		return addrLinkLocal
+	case ip.To4() != nil:
+		return addrIPv4
+	case ip.IsGlobalUnicast():
+		return addrIPv6Global
+	}
+	return addrOther
+}
+
+// addrLines lists addresses grouped by kind, IPv4 first, each labelled
+// with its kind. Link-local and loopback addresses are dimmed so the
+// routable ones stand out.
+func addrLines(addrs []net.Addr) string {
+	sorted := slices.Clone(addrs)
+	slices.SortStableFunc(sorted, func(a, b net.Addr) int { return addrKind(a) - addrKind(b) })
+	s := ""
+	for _, addr := range sorted {
+		kind := addrKind(addr)
+		line := fmt.Sprintf("   %-12s%s", addrKindNames[kind], addr.String())
+		if kind == addrLinkLocal || kind == addrLoopback {
+			line = mutedStyle.Render(line)
+		}
+		s += line + "\n"
+	}
+	return s
+}
+
+// ifaceDetails renders the hardware address, MTU and link speed of iface.
+func ifaceDetails(iface net.Interface) string {
+	mac := iface.HardwareAddr.String()
+	if mac == "" {
+		mac = "n/a"
+	}
+	mtu := "n/a"
+	if iface.MTU > 0 {
+		mtu = strconv.Itoa(iface.MTU)
+	}
+	return fmt.Sprintf("   MAC: %s  MTU: %s  Speed: %s\n", mac, mtu, linkSpeed(iface.Name))
+}
+
+// recordRates derives per-second rates from the change in each
+// interface's counters since the previous sample. It returns the rates
+// summed over all interfaces, and false if there was no previous sample.
+func (m *Model) recordRates(now time.Time) (sent, recv float64, ok bool) {
+	if m.history == nil {
+		m.history = make(map[string]*rateHistory)
+	}
+	if m.rates == nil {
+		m.rates = &rate.Tracker{CounterBits: *counterBits}
+	}
+	readings := make(map[string][]uint64, len(m.networkStats))
+	for _, stat := range m.networkStats {
+		readings[stat.Name] = []uint64{stat.BytesSent, stat.BytesRecv}
+	}
+	if m.smoothed == nil {
+		m.smoothed = make(map[string]*[2]rate.EWMA)
+		m.activity = make(map[string]float64)
+	}
+	for name, r := range m.rates.Update(now, readings) {
+		sm := m.smoothed[name]
+		if sm == nil {
+			pair := smoothPair()
+			sm = &pair
+			m.smoothed[name] = sm
+		}
+		sm[0].Add(r[0])
+		sm[1].Add(r[1])
+		h := m.history[name]
+		if h == nil {
+			h = &rateHistory{}
+			m.history[name] = h
+		}
+		h.add(r[0], r[1])
+		m.activity[name] = activityScore(h)
+		if t := m.sessionByIface[name]; t != nil {
+			t.PeakSent, t.PeakRecv = max(t.PeakSent, r[0]), max(t.PeakRecv, r[1])
+		}
+		if m.log != nil {
+			at := now
+			if *utcFlag {
+				at = at.UTC()
+			}
+			m.log.Log(rateRecord{Time: at, Interface: name, SentBps: r[0], RecvBps: r[1]})
+		}
+		sent += r[0]
+		recv += r[1]
+		ok = true
+	}
+	return sent, recv, ok
+}
+
+// addSession adds the bytes each interface moved since the previous sample
+// to the session totals. Counters that wrapped are counted across the
+// wrap; those that went backwards after a device reset only set a new
+// baseline, and interfaces that disappear keep what they already
+// contributed.
+func (m *Model) addSession() {
+	if m.sessionPrev == nil {
+		m.sessionPrev = make(map[string][2]uint64, len(m.networkStats))
+		m.sessionByIface = make(map[string]*ifaceTotals, len(m.networkStats))
+	}
+	for _, stat := range m.networkStats {
+		cur := [2]uint64{stat.BytesSent, stat.BytesRecv}
+		if prev, ok := m.sessionPrev[stat.Name]; ok {
+			sent, sentOK := rate.Delta(prev[0], cur[0], *counterBits)
+			recv, recvOK := rate.Delta(prev[1], cur[1], *counterBits)
+			if sentOK && recvOK {
+				m.sessionSent += sent
+				m.sessionRecv += recv
+				t := m.sessionByIface[stat.Name]
+				t.Sent += sent
+				t.Recv += recv
+			}
+		}
+		m.sessionPrev[stat.Name] = cur
+		if m.sessionByIface[stat.Name] == nil {
+			m.sessionByIface[stat.Name] = &ifaceTotals{}
+		}
+	}
+}
+
+// smoothPair returns averages for a sent and a received rate, weighted by
+// -alpha.
+func smoothPair() [2]rate.EWMA {
+	return [2]rate.EWMA{{Alpha: *alphaFlag}, {Alpha: *alphaFlag}}
+}
+
+// shown returns the rate history the sparklines and graph draw: values
+// itself, or smoothed when s has switched them to smoothed rates.
+func (m Model) shown(values []float64) []float64 {
+	if m.smoothBars {
+		return rate.Smooth(values, *alphaFlag)
+	}
+	return values
+}
+
+// formatRate formats a rate in bytes per second in the chosen unit.
+func (m Model) formatRate(bytesPerSec float64) string {
+	if m.bits {
+		return units.Bits(bytesPerSec)
+	}
+	return units.Rate(bytesPerSec)
+}
+
+// summaryLine rolls up the current total rates and the bytes moved this
+// session. Rates show "--" until two samples have been taken.
+func (m Model) summaryLine() string {
+	sent, recv := "--", "--"
+	if len(m.historySent) > 0 {
+		sent = fmt.Sprintf("%s (~%s)", m.formatRate(m.rateSent), m.formatRate(m.smoothTotal[0].Value()))
+		recv = fmt.Sprintf("%s (~%s)", m.formatRate(m.rateRecv), m.formatRate(m.smoothTotal[1].Value()))
+	}
+	return fmt.Sprintf("All interfaces: ↑ %s  ↓ %s · this session ↑ %s  ↓ %s",
+		sent, recv, units.Bytes(float64(m.sessionSent)), units.Bytes(float64(m.sessionRecv)))
+}
+
+// historyStateName is the state file the rate history is saved to.
+const historyStateName = "network-monitor-history"
+
+// historyMaxAge is how old saved history may be and still be restored.
+const historyMaxAge = 5 * time.Minute
+
+// savedHistory is the on-disk form of the rate history.
+type savedHistory struct {
+	Saved      time.Time               `json:"saved"`
+	Interfaces map[string]*rateHistory `json:"interfaces"`
+
+	// The refresh interval chosen with +/-, restored unless -interval or
+	// -max-interval is given. Durations are in nanoseconds.
+	Interval    time.Duration `json:"interval,omitempty"`
+	MaxInterval time.Duration `json:"max_interval,omitempty"`
+}
+
+// loadHistory returns the saved state. Interfaces is nil if there is no
+// history or it is too old to be useful.
+func loadHistory() savedHistory {
+	var saved savedHistory
+	if err := state.Load(historyStateName, &saved); err != nil {
+		return savedHistory{}
+	}
+	if time.Since(saved.Saved) > historyMaxAge {
+		saved.Interfaces = nil
+	}
+	for _, h := range saved.Interfaces {
+		h.Sent = trimHistory(h.Sent)
+		h.Recv = trimHistory(h.Recv)
+	}
+	return saved
+}
+
+// saveHistory writes the rate history and refresh interval to the state
+// file.
+func saveHistory(history map[string]*rateHistory, pacer *pace.Pacer) error {
+	return state.Save(historyStateName, savedHistory{
+		Saved:       time.Now(),
+		Interfaces:  history,
+		Interval:    pacer.Min,
+		MaxInterval: pacer.Max,
+	})
+}
+
 const maxBarWidth = 50        // maximum bar width in characters
 const scaleFactor = 1000000.0 // 1 unit per 1MB
 
+var (
+	themeFlag   = flag.String("theme", "", "theme name (dark, light) or path to a theme file")
+	paletteFlag = flag.String("palette", "", "colour override applied on top of the theme: colorblind")
+	versionFlag = flag.Bool("version", false, "print version information and exit")
+	inlineFlag  = flag.Bool("inline", false, "draw in place below the prompt, leaving the output in the scrollback, instead of using the whole screen")
+	asciiFlag   = flag.Bool("ascii", false, "draw bars with # and - instead of coloured blocks")
+	jsonFlag    = flag.Bool("json", false, "print the session summary on quit as JSON")
+	bitsFlag    = flag.Bool("bits", false, "show rates in bits per second (Mb/s) instead of bytes (MB/s)")
+	onceFlag    = flag.Bool("once", false, "print interfaces and counters once and exit")
+	historyFlag = flag.Int("history", historyLen, fmt.Sprintf("number of samples of history to keep (max %d)", maxHistoryLen))
+	ifaceMax    = flag.String("iface-max", "", "capacity of each interface, scaling its sparklines, e.g. eth0=1Gb,tun0=50Mb (b bits, B bytes)")
+	timeFmtFlag = flag.String("timefmt", "short", "timestamp format: short (15:04:05), rfc3339 or rfc1123")
+	utcFlag     = flag.Bool("utc", false, "show timestamps, and write -log rows, in UTC rather than local time")
+	alphaFlag   = flag.Float64("alpha", 0.3, "weight of each new sample in the smoothed rates, above 0 and at most 1; lower is smoother")
+	counterBits = flag.Int("counter-bits", 0, "width of the byte counters, 32 or 64, to tell a wrap from a reset; 0 guesses")
+	remoteFlag  = flag.String("remote", "", "monitor a Linux host over SSH instead of this machine, as user@host[:port]")
+	sshKeyFlag  = flag.String("ssh-key", "", "private key file for -remote; default the SSH agent, then ~/.ssh/id_*")
+	logFlag     = flag.String("log", "", "append per-interface rate samples as JSON lines to this file")
+	logSizeFlag = flag.Int("log-size", 10, "rotate the -log file when it exceeds this many MB")
+	logKeepFlag = flag.Int("log-keep", 5, "number of rotated -log files to keep")
+
+	intervalFlag = flag.Duration("interval", 5*time.Second, "time between refreshes")
+	maxInterval  = flag.Duration("max-interval", 30*time.Second,
+		"slowest refresh, reached while the network is quiet; at or below -interval disables slowing down")
+)
+
 // Add new network bar styles (similar to system monitor)
 var (
-	barBaseStyle    = lipgloss.NewStyle().Background(lipgloss.Color("#333333")).PaddingLeft(1).PaddingRight(1)
-	netSentBarStyle = lipgloss.NewStyle().Background(lipgloss.Color("#FFB86C"))
-	netRecvBarStyle = lipgloss.NewStyle().Background(lipgloss.Color("#8BE9FD"))
+	barBaseStyle    lipgloss.Style
+	netSentBarStyle lipgloss.Style
+	netRecvBarStyle lipgloss.Style
+	graphSentStyle  lipgloss.Style
+	graphRecvStyle  lipgloss.Style
+	graphBothStyle  lipgloss.Style
+	eventUpStyle    lipgloss.Style
+	eventDownStyle  lipgloss.Style
+	mutedStyle      lipgloss.Style
 )
 
-// Modify renderBar to accept maximum width and fill style.
-func renderBar(value float64, maxWidth int, fillStyle lipgloss.Style) string {
-	barWidth := int(value / scaleFactor)
-	if barWidth > maxWidth {
-		barWidth = maxWidth
+// Bar fill characters for patterned palettes and -ascii; empty draws a
+// solid background-coloured bar.
+var sentFill, recvFill string
+
+// applyASCII switches the bars to plain # and - characters, for terminals
+// that draw background colours poorly and for copying into text.
+func applyASCII() {
+	barBaseStyle = lipgloss.NewStyle().PaddingLeft(1).PaddingRight(1)
+	netSentBarStyle, netRecvBarStyle = lipgloss.NewStyle(), lipgloss.NewStyle()
+	sentFill, recvFill = "#", "#"
+	ui.BarBase, ui.EmptyChar = barBaseStyle, "-"
+}
+
+// applyTheme builds the bar styles from the palette.
+func applyTheme(p theme.Palette) {
+	barBaseStyle = lipgloss.NewStyle().Background(lipgloss.Color(p.BarBase)).PaddingLeft(1).PaddingRight(1)
+	netSentBarStyle = lipgloss.NewStyle().Background(lipgloss.Color(p.Sent))
+	netRecvBarStyle = lipgloss.NewStyle().Background(lipgloss.Color(p.Recv))
+	graphSentStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(p.Sent))
+	graphRecvStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(p.Recv))
+	graphBothStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(p.Text))
+	eventUpStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(p.Success))
+	eventDownStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(p.Error))
+	mutedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(p.Muted))
+	errRisingStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(p.Error)).Bold(true)
+	activityStyles = []lipgloss.Style{mutedStyle, lipgloss.NewStyle().Foreground(lipgloss.Color(p.Text)),
+		lipgloss.NewStyle().Foreground(lipgloss.Color(p.Info)), lipgloss.NewStyle().Foreground(lipgloss.Color(p.Accent)).Bold(true)}
+
+	sentFill, recvFill = "", ""
+	if p.Patterned {
+		netSentBarStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(p.Sent))
+		netRecvBarStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(p.Recv))
+		sentFill, recvFill = "█", "▒"
+	}
+	ui.BarBase = barBaseStyle
+}
+
+// renderBar draws value as a bar of up to maxWidth cells, one cell per
+// scaleFactor bytes.
+func renderBar(value float64, maxWidth int, fillStyle lipgloss.Style, fill string) string {
+	return ui.PatternBar(value, float64(maxWidth)*scaleFactor, maxWidth, fillStyle, fill)
+}
+
+// barLine renders label, a bar of up to maxWidth cells and the byte count
+// on one line that fits the terminal, so it never wraps. The bar shrinks
+// first, keeping one cell per MB; if the label and count alone are too
+// wide, the count is cut short.
+func (m Model) barLine(label string, value uint64, maxWidth int, fillStyle lipgloss.Style, fill string) string {
+	suffix := fmt.Sprintf(" %d B", value)
+	if m.width > 0 {
+		maxWidth = min(maxWidth, m.width-len(label)-len(suffix))
+	}
+	if maxWidth < 1 {
+		line := label + strings.TrimPrefix(suffix, " ")
+		if len(line) > m.width {
+			line = line[:max(m.width-1, 0)] + "…"
+		}
+		return line
 	}
-	filled := fillStyle.Width(barWidth).Render("")
-	empty := lipgloss.NewStyle().Width(maxWidth - barWidth).Render("")
-	return barBaseStyle.Render(filled + empty)
+	return label + renderBar(float64(value), maxWidth, fillStyle, fill) + suffix
+}
+
+// refreshingNote marks a refresh asked for with r until it lands.
+func (m Model) refreshingNote() string {
+	if m.refreshing {
+		return " · refreshing..."
+	}
+	return ""
 }
 
 func (m Model) View() string {
-	s := "Network Monitor\n\n"
-	if m.err != nil {
-		s += fmt.Sprintf("Error: %v\n", m.err)
-		return s
+	s := "Network Monitor"
+	if remote != nil {
+		s += " — " + remote.name
 	}
-	s += fmt.Sprintf("Last Update: %s\n\n", m.lastUpdate.Format(time.RFC1123))
-	s += "Interfaces:\n"
-	for _, iface := range m.interfaces {
-		s += fmt.Sprintf("- %s, Flags: %v\n", iface.Name, iface.Flags)
-		addrs, err := iface.Addrs()
-		if err == nil {
-			for _, addr := range addrs {
-				s += fmt.Sprintf("   %s\n", addr.String())
-			}
+	s += "\n\n" + m.primaryView()
+	s += fmt.Sprintf("Last Update: %s\n", stamp(m.lastUpdate))
+	if m.lastErr != nil {
+		ago := time.Since(m.lastErrAt).Truncate(time.Second)
+		line := fmt.Sprintf("Last Error: %v (%s, %s ago)", m.lastErr, stamp(m.lastErrAt), ago)
+		if m.ifaceErr == nil && m.statsErr == nil {
+			s += mutedStyle.Render(line+" — recovered") + "\n"
+		} else {
+			s += eventDownStyle.Render(line) + "\n"
 		}
 	}
-	s += "\nNetwork Activity:\n"
-	for _, stat := range m.networkStats {
-		s += fmt.Sprintf("- %s: Sent: %d B, Received: %d B\n", stat.Name, stat.BytesSent, stat.BytesRecv)
+	s += "\n"
+	s += "Interfaces:\n"
+	switch {
+	case m.ifaceErr != nil:
+		s += eventDownStyle.Render(fmt.Sprintf("Error listing interfaces: %v", m.ifaceErr)) + "\n"
+	case m.seenInterfaces && len(m.interfaces) == 0:
+		s += mutedStyle.Render("No network interfaces detected") + "\n"
+	}
+	top := s
+	s = "\nNetwork Activity:\n"
+	switch {
+	case m.statsErr != nil:
+		s += eventDownStyle.Render(fmt.Sprintf("Error reading network statistics: %v", m.statsErr)) + "\n"
+	case m.seenStats && len(m.networkStats) == 0:
+		s += mutedStyle.Render("No network statistics available") + "\n"
+	}
+	if len(m.networkStats) > 0 {
+		s += fmt.Sprintf("Total: Sent: %d B, Received: %d B\n", m.latestSent, m.latestRecv)
 	}
 	s += "\nNetwork Bar Graphs:\n"
 	// Use a fixed max width for the network bars (similar to system monitor)
 	maxWidth := 50
-	s += fmt.Sprintf("Sent: %s %d B\n", renderBar(float64(m.latestSent), maxWidth, netSentBarStyle), m.latestSent)
-	s += fmt.Sprintf("Recv: %s %d B\n", renderBar(float64(m.latestRecv), maxWidth, netRecvBarStyle), m.latestRecv)
-	s += "\nPress q to quit.\n"
+	s += m.barLine("Sent: ", m.latestSent, maxWidth, netSentBarStyle, sentFill) + "\n"
+	s += m.barLine("Recv: ", m.latestRecv, maxWidth, netRecvBarStyle, recvFill) + "\n"
+	if len(m.historySent) > 1 {
+		width := m.width
+		if width == 0 {
+			width = 80
+		}
+		kind := ""
+		if m.smoothBars {
+			kind = ", smoothed"
+		}
+		s += "\nBandwidth (" + graphSentStyle.Render("sent") + " / " + graphRecvStyle.Render("recv") + kind + "):\n"
+		s += renderGraph(m.shown(m.historySent), m.shown(m.historyRecv), width, graphHeight, m.formatRate)
+	}
+	if len(m.events) > 0 {
+		s += "\nEvents:\n"
+		for _, e := range m.events {
+			line := stamp(e.at) + "  " + e.String()
+			switch {
+			case time.Since(e.at) > toastDuration:
+				line = mutedStyle.Render(line)
+			case e.what == "UP" || e.what == "ADDED":
+				line = eventUpStyle.Render(line)
+			default:
+				line = eventDownStyle.Render(line)
+			}
+			s += line + "\n"
+		}
+	}
+	s += "\n★ primary interface. ↑↓/jk to select, Enter for details, b for bits/bytes, s for smoothed/raw graphs, r to refresh now, +/- to change speed, q to quit." +
+		mutedStyle.Render(fmt.Sprintf("  · every %s%s", m.pacer.Interval(), m.refreshingNote())) + "\n"
+	s += m.summaryLine() + "\n"
+	if m.statsTook > m.pacer.Interval() {
+		s += eventDownStyle.Render(fmt.Sprintf("⚠ Sampling lag: reading the counters took %s, longer than the %s interval",
+			m.statsTook.Round(100*time.Millisecond), m.pacer.Interval())) + "\n"
+	}
+
+	budget := 0 // unlimited until the terminal size is known
+	if m.height > 0 {
+		// Leave a line for each "more" marker, but always show the selection.
+		budget = max(m.height-lineCount(top)-lineCount(s)-2, 1)
+	}
+	return top + m.interfaceList(budget) + s
+}
+
+// interfaceList renders each interface with its addresses and counters. With a
+// positive budget only as many lines are drawn as fit, scrolled to keep the
+// selected interface visible, and the hidden count is shown below.
+func (m Model) interfaceList(budget int) string {
+	infos := m.joined()
+	blocks := make([]string, len(infos))
+	for i, info := range infos {
+		blocks[i] = m.interfaceBlock(i, info)
+	}
+	if budget <= 0 {
+		return strings.Join(blocks, "")
+	}
+
+	// Start as early as possible while still reaching the selection, then
+	// fill the remaining space after it.
+	fits := func(from, to int) bool {
+		lines := 0
+		for _, b := range blocks[from:to] {
+			lines += strings.Count(b, "\n")
+		}
+		return lines <= budget
+	}
+	start, end := 0, min(m.selected+1, len(blocks))
+	for start < end-1 && !fits(start, end) {
+		start++
+	}
+	for end < len(blocks) && fits(start, end+1) {
+		end++
+	}
+
+	s := ""
+	if start > 0 {
+		s += mutedStyle.Render(fmt.Sprintf("  ↑ %d more", start)) + "\n"
+	}
+	s += strings.Join(blocks[start:end], "")
+	if end < len(blocks) {
+		s += mutedStyle.Render(fmt.Sprintf("  ↓ %d more", len(blocks)-end)) + "\n"
+	}
+	return s
+}
+
+// interfaceBlock renders one interface line followed by its addresses,
+// counters and rate sparklines.
+func (m Model) interfaceBlock(i int, info ifaceInfo) string {
+	marker := "-"
+	if i == m.selected {
+		marker = ">"
+	}
+	name := m.heat(info.Name)
+	if info.Name == m.primary {
+		name += " ★"
+	}
+	if m.errorsRising(info.Name) {
+		name += " " + errRisingStyle.Render("⚠ errors rising")
+	}
+	if info.Iface == nil {
+		return fmt.Sprintf("%s %s, %s\n", marker, name, mutedStyle.Render("not in the interface list")) + m.countersLines(info)
+	}
+	s := fmt.Sprintf("%s %s, Flags: %v\n", marker, name, info.Iface.Flags)
+	if i == m.selected && m.expanded {
+		s += ifaceDetails(*info.Iface)
+	}
+	// Remote interfaces have no addresses; Addrs would look up local ones.
+	if remote == nil {
+		if addrs, err := info.Iface.Addrs(); err == nil {
+			s += addrLines(addrs)
+		}
+	}
+	return s + m.countersLines(info)
+}
+
+// countersLines renders an interface's byte counters and rate history.
+func (m Model) countersLines(info ifaceInfo) string {
+	if info.Stats == nil {
+		if !m.seenStats {
+			return ""
+		}
+		return mutedStyle.Render("   no counters") + "\n"
+	}
+	s := fmt.Sprintf("   Sent: %d B, Received: %d B\n", info.Stats.BytesSent, info.Stats.BytesRecv)
+	if h := m.history[info.Name]; h != nil {
+		if sm := m.smoothed[info.Name]; sm != nil && len(h.Sent) > 0 {
+			s += fmt.Sprintf("   now ↑ %s  ↓ %s · smoothed ↑ %s  ↓ %s\n", m.formatRate(h.Sent[len(h.Sent)-1]), m.formatRate(h.Recv[len(h.Recv)-1]),
+				m.formatRate(sm[0].Value()), m.formatRate(sm[1].Value()))
+		}
+		h = &rateHistory{Sent: m.shown(h.Sent), Recv: m.shown(h.Recv)}
+		sparkWidth := (m.width - 10) / 2
+		if m.width == 0 {
+			sparkWidth = 35
+		}
+		// Interfaces without a configured capacity scale to their own peak.
+		if capacity, ok := m.capacity[info.Name]; ok {
+			s += fmt.Sprintf("   ↑ %s  ↓ %s\n", ui.SparklineScaled(h.Sent, sparkWidth, capacity), ui.SparklineScaled(h.Recv, sparkWidth, capacity))
+			s += "   " + m.utilisation(h, capacity) + "\n"
+		} else {
+			s += fmt.Sprintf("   ↑ %s  ↓ %s\n", ui.Sparkline(h.Sent, sparkWidth), ui.Sparkline(h.Recv, sparkWidth))
+		}
+		s += m.errorsLine(info.Name, sparkWidth)
+	}
 	return s
 }
 
+// lineCount is the number of lines s occupies.
+func lineCount(s string) int {
+	return strings.Count(s, "\n") + 1
+}
+
+// printOnce prints the interfaces and their counters as plain text.
+func printOnce() error {
+	interfaces, err := listInterfaces()
+	if err != nil {
+		return fmt.Errorf("listing interfaces: %w", err)
+	}
+	stats, err := readCounters()
+	if err != nil {
+		return fmt.Errorf("reading network statistics: %w", err)
+	}
+
+	fmt.Println("Interfaces:")
+	for _, iface := range interfaces {
+		fmt.Printf("- %s, Flags: %v\n", iface.Name, iface.Flags)
+		if addrs, err := iface.Addrs(); err == nil && remote == nil {
+			fmt.Print(addrLines(addrs))
+		}
+	}
+	fmt.Println("\nNetwork Activity:")
+	for _, stat := range stats {
+		fmt.Printf("- %s: Sent: %d B, Received: %d B\n", stat.Name, stat.BytesSent, stat.BytesRecv)
+	}
+	return nil
+}
+
 func main() {
-	p := tea.NewProgram(Model{})
-	if err := p.Start(); err != nil {
+	flag.Parse()
+
+	if *versionFlag {
+		fmt.Println(version.String("network-monitor"))
+		return
+	}
+
+	palette, warnings := theme.Load(*themeFlag)
+	for _, w := range warnings {
+		fmt.Fprintln(os.Stderr, w)
+	}
+	palette, err := theme.Override(palette, *paletteFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		exit(2)
+	}
+	if ui.BasicColors() {
+		palette = palette.Basic()
+	}
+	applyTheme(palette)
+	if theme.NoColor() {
+		// Without colour the bars would be blank, so draw them in ASCII.
+		ui.Plain()
+		applyASCII()
+	} else if *asciiFlag {
+		applyASCII()
+	}
+
+	switch {
+	case *historyFlag < 2:
+		fmt.Fprintln(os.Stderr, "Error: -history must be at least 2")
+		exit(2)
+	case *historyFlag > maxHistoryLen:
+		fmt.Fprintf(os.Stderr, "-history capped at %d\n", maxHistoryLen)
+		historyLen = maxHistoryLen
+	default:
+		historyLen = *historyFlag
+	}
+
+	if *intervalFlag <= 0 {
+		fmt.Fprintln(os.Stderr, "Error: -interval must be positive")
+		exit(2)
+	}
+
+	layout, ok := timeLayouts[strings.ToLower(*timeFmtFlag)]
+	if !ok {
+		fmt.Fprintln(os.Stderr, "Error: -timefmt must be short, rfc3339 or rfc1123")
+		exit(2)
+	}
+	timeLayout = layout
+
+	if *counterBits != 0 && *counterBits != 32 && *counterBits != 64 {
+		fmt.Fprintln(os.Stderr, "Error: -counter-bits must be 0, 32 or 64")
+		exit(2)
+	}
+
+	if !(*alphaFlag > 0 && *alphaFlag <= 1) {
+		fmt.Fprintln(os.Stderr, "Error: -alpha must be above 0 and at most 1")
+		exit(2)
+	}
+
+	capacity, err := parseIfaceMax(*ifaceMax)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: -iface-max:", err)
+		exit(2)
+	}
+
+	if *remoteFlag != "" {
+		r, err := dialRemote(*remoteFlag, *sshKeyFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: -remote:", err)
+			exit(1)
+		}
+		remote = r
+		defer closeRemote()
+	} else if *sshKeyFlag != "" {
+		fmt.Fprintln(os.Stderr, "Error: -ssh-key needs -remote")
+		exit(2)
+	}
+
+	if !*onceFlag && !term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Fprintln(os.Stderr, "network-monitor: stdout is not a terminal; printing once as with -once")
+		*onceFlag = true
+	}
+	if *onceFlag {
+		if err := printOnce(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			exit(1)
+		}
+		return
+	}
+
+	saved := loadHistory()
+	if remote != nil {
+		saved.Interfaces = nil // the saved history is this machine's
+	}
+	model := Model{
+		history:     saved.Interfaces,
+		bits:        *bitsFlag,
+		started:     time.Now(),
+		capacity:    capacity,
+		smoothTotal: smoothPair(),
+		smoothBars:  true,
+		pacer:       &pace.Pacer{Min: *intervalFlag, Max: max(*maxInterval, *intervalFlag), IdleAfter: idleAfter},
+	}
+	intervalSet := false
+	flag.Visit(func(f *flag.Flag) {
+		intervalSet = intervalSet || f.Name == "interval" || f.Name == "max-interval"
+	})
+	if !intervalSet && saved.Interval >= pace.Fastest && saved.Interval <= pace.Slowest {
+		model.pacer.Min = saved.Interval
+		model.pacer.Max = max(saved.MaxInterval, saved.Interval)
+	}
+	// Until the program takes over the terminal, Ctrl+C arrives as SIGINT;
+	// catch it, and SIGTERM, so the log is still flushed and closed.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	if *logFlag != "" {
+		if *logSizeFlag < 1 || *logKeepFlag < 0 {
+			fmt.Fprintln(os.Stderr, "Error: -log-size must be at least 1 and -log-keep at least 0")
+			exit(2)
+		}
+		log, err := openRateLog(*logFlag, int64(*logSizeFlag)<<20, *logKeepFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error opening log:", err)
+			exit(1)
+		}
+		model.log = log
+	}
+
+	var opts []tea.ProgramOption
+	if !*inlineFlag {
+		opts = append(opts, tea.WithAltScreen())
+	}
+	p := tea.NewProgram(model, opts...)
+	go func() {
+		<-signals
+		p.Quit()
+	}()
+	final, err := p.Run()
+	if model.log != nil {
+		if cerr := model.log.Close(); cerr != nil {
+			fmt.Fprintln(os.Stderr, "Error writing log:", cerr)
+		}
+	}
+	if err != nil {
 		fmt.Printf("Error: %v\n", err)
-		os.Exit(1)
+		exit(1)
+	}
+	if m, ok := final.(Model); ok {
+		if remote == nil {
+			if err := saveHistory(m.history, m.pacer); err != nil {
+				fmt.Fprintln(os.Stderr, "Error saving history:", err)
+			}
+		}
+		if err := m.writeSummary(os.Stdout, time.Now(), *jsonFlag); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
 	}
 }
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// primaryProbeAddr is dialed to find the interface carrying the default
+// route. Dialing UDP only picks a route; nothing is sent.
+const primaryProbeAddr = "8.8.8.8:53"
+
+// primaryEvery is how many ticks pass between primary interface lookups;
+// the default route rarely changes.
+const primaryEvery = 6
+
+// primaryMsg names the primary interface, or is empty if there is none.
+type primaryMsg string
+
+// fetchPrimary finds the interface whose address the OS would use to reach
+// the internet, or with -remote the one the remote host's default route
+// uses.
+func fetchPrimary() tea.Msg {
+	if remote != nil {
+		return primaryMsg(remote.primary())
+	}
+	conn, err := net.Dial("udp", primaryProbeAddr)
+	if err != nil {
+		return primaryMsg("")
+	}
+	local := conn.LocalAddr().(*net.UDPAddr).IP
+	conn.Close()
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return primaryMsg("")
+	}
+	for _, iface := range interfaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.Equal(local) {
+				return primaryMsg(iface.Name)
+			}
+		}
+	}
+	return primaryMsg("")
+}
+
+// headline picks the interface shown at the top: the primary one, or if
+// there is none, the non-loopback interface moving the most data. why
+// says which it is; name is empty until one can be picked.
+func (m Model) headline() (name, why string) {
+	if m.primary != "" {
+		return m.primary, "default route"
+	}
+	loopback := make(map[string]bool)
+	for _, iface := range m.interfaces {
+		loopback[iface.Name] = iface.Flags&net.FlagLoopback != 0
+	}
+	best := -1.0
+	for n, h := range m.history {
+		if loopback[n] || len(h.Sent) == 0 {
+			continue
+		}
+		if total := h.Sent[len(h.Sent)-1] + h.Recv[len(h.Recv)-1]; total > best {
+			name, best = n, total
+		}
+	}
+	return name, "busiest, no default route found"
+}
+
+// primaryView renders the headline interface's rates, raw and smoothed,
+// whatever is selected or scrolled in the list below.
+func (m Model) primaryView() string {
+	name, why := m.headline()
+	if name == "" {
+		return ""
+	}
+	sent, recv := "--", "--"
+	if h := m.history[name]; h != nil && len(h.Sent) > 0 {
+		sent, recv = m.formatRate(h.Sent[len(h.Sent)-1]), m.formatRate(h.Recv[len(h.Recv)-1])
+		if sm := m.smoothed[name]; sm != nil {
+			sent += mutedStyle.Render(" (~" + m.formatRate(sm[0].Value()) + ")")
+			recv += mutedStyle.Render(" (~" + m.formatRate(sm[1].Value()) + ")")
+		}
+	}
+	return fmt.Sprintf("★ %s %s\n  %s %s   %s %s\n\n", name, mutedStyle.Render("· "+why),
+		graphSentStyle.Bold(true).Render("↑"), sent, graphRecvStyle.Bold(true).Render("↓"), recv)
+}
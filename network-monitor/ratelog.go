@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// rateRecord is one line of the rate log.
+type rateRecord struct {
+	Time      time.Time `json:"time"`
+	Interface string    `json:"interface"`
+	SentBps   float64   `json:"sent_bytes_per_sec"`
+	RecvBps   float64   `json:"recv_bytes_per_sec"`
+}
+
+// rateLog appends rate records to a JSON-lines file in the background,
+// rotating it once it grows past maxSize. Writes are buffered and flushed
+// whenever the queue runs empty, and on Close. Rotated files are named
+// path.1 (newest) to path.<keep>; older ones are deleted.
+type rateLog struct {
+	path    string
+	maxSize int64
+	keep    int
+
+	records chan rateRecord
+	done    sync.WaitGroup
+	file    *os.File
+	buf     *bufio.Writer
+	size    int64
+	err     error // first write error, reported on Close
+}
+
+// openRateLog opens path for appending and starts the writer.
+func openRateLog(path string, maxSize int64, keep int) (*rateLog, error) {
+	l := &rateLog{path: path, maxSize: maxSize, keep: keep, records: make(chan rateRecord, 256)}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	l.done.Add(1)
+	go l.run()
+	return l, nil
+}
+
+// Log queues a record. It never blocks the UI: if the writer has fallen
+// far behind the record is dropped.
+func (l *rateLog) Log(r rateRecord) {
+	select {
+	case l.records <- r:
+	default:
+	}
+}
+
+// Close writes any queued records, flushes them and closes the file.
+func (l *rateLog) Close() error {
+	close(l.records)
+	l.done.Wait()
+	if err := l.buf.Flush(); err != nil && l.err == nil {
+		l.err = err
+	}
+	if err := l.file.Close(); err != nil && l.err == nil {
+		l.err = err
+	}
+	return l.err
+}
+
+func (l *rateLog) run() {
+	defer l.done.Done()
+	for r := range l.records {
+		err := l.write(r)
+		if err == nil && len(l.records) == 0 {
+			err = l.buf.Flush()
+		}
+		if err != nil && l.err == nil {
+			l.err = err
+		}
+	}
+}
+
+func (l *rateLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.file, l.buf, l.size = f, bufio.NewWriter(f), info.Size()
+	return nil
+}
+
+func (l *rateLog) write(r rateRecord) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.buf.Write(line)
+	l.size += int64(n)
+	return err
+}
+
+// rotate shifts path.N to path.N+1, dropping the oldest, and starts a
+// fresh file at path.
+func (l *rateLog) rotate() error {
+	if err := l.buf.Flush(); err != nil {
+		return err
+	}
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	os.Remove(fmt.Sprintf("%s.%d", l.path, l.keep))
+	for i := l.keep - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+	}
+	if l.keep > 0 {
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(l.path); err != nil {
+		return err
+	}
+	return l.open()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// readRecords reads the records in a rate log file, failing on lines that
+// do not parse.
+func readRecords(t *testing.T, path string) []rateRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []rateRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r rateRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("%s: bad line %q: %v", path, scanner.Text(), err)
+		}
+		records = append(records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func record(i int) rateRecord {
+	return rateRecord{Time: time.Unix(1000+int64(i), 0).UTC(), Interface: fmt.Sprintf("eth%d", i), SentBps: float64(i), RecvBps: float64(2 * i)}
+}
+
+func TestRateLogCloseFlushes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.jsonl")
+	l, err := openRateLog(path, 10<<20, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 5 {
+		l.Log(record(i))
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	records := readRecords(t, path)
+	if len(records) != 5 {
+		t.Fatalf("got %d records, want 5", len(records))
+	}
+	if last := records[len(records)-1]; last != record(4) {
+		t.Errorf("last record = %+v, want %+v", last, record(4))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[len(data)-1] != '\n' {
+		t.Errorf("file does not end with a complete line")
+	}
+}
+
+func TestRateLogRotates(t *testing.T) {
+	for _, keep := range []int{0, 2} {
+		t.Run(fmt.Sprintf("keep %d", keep), func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "rates.jsonl")
+			line, _ := json.Marshal(record(0))
+			// Room for two lines per file.
+			maxSize := int64(2*(len(line)+1) + 5)
+			l, err := openRateLog(path, maxSize, keep)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range 9 {
+				l.Log(record(i))
+			}
+			if err := l.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			files := []string{path}
+			for i := 1; i <= keep; i++ {
+				files = append(files, fmt.Sprintf("%s.%d", path, i))
+			}
+			if _, err := os.Stat(fmt.Sprintf("%s.%d", path, keep+1)); !os.IsNotExist(err) {
+				t.Errorf("%s.%d exists beyond -log-keep %d", path, keep+1, keep)
+			}
+			// Newest first: path holds the last record, path.1 the two
+			// before it, and so on.
+			next := 8
+			for _, f := range files {
+				info, err := os.Stat(f)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Size() > maxSize {
+					t.Errorf("%s is %d bytes, over the %d limit", f, info.Size(), maxSize)
+				}
+				records := readRecords(t, f)
+				for i := len(records) - 1; i >= 0; i-- {
+					if records[i] != record(next) {
+						t.Errorf("%s: record %d = %+v, want %+v", f, i, records[i], record(next))
+					}
+					next--
+				}
+			}
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("current log missing: %v", err)
+			}
+		})
+	}
+}
+
+func TestRateLogAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.jsonl")
+	for i := range 2 {
+		l, err := openRateLog(path, 10<<20, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.Log(record(i))
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if records := readRecords(t, path); len(records) != 2 || records[1] != record(1) {
+		t.Errorf("records after reopening = %+v, want two ending with %+v", records, record(1))
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	psnet "github.com/shirou/gopsutil/net"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/term"
+)
+
+// remote is the host monitored over SSH with -remote, or nil to monitor
+// this machine.
+var remote *remoteHost
+
+// remoteHost reads a Linux host's network state over SSH. Each read runs
+// one command in a new session on the same connection, so nothing needs
+// installing on the host.
+type remoteHost struct {
+	name   string // user@host as given to -remote
+	client *ssh.Client
+}
+
+// Commands run on the remote host. The interface list comes from sysfs,
+// one line per interface: name, flags in hex, MTU and hardware address.
+const (
+	remoteCountersCmd = "cat /proc/net/dev"
+	remoteRouteCmd    = "cat /proc/net/route"
+	remoteIfacesCmd   = `cd /sys/class/net && for i in *; do echo "$i $(cat $i/flags) $(cat $i/mtu) $(cat $i/address)"; done`
+)
+
+// sshTimeout bounds connecting to the remote host.
+const sshTimeout = 10 * time.Second
+
+// dialRemote connects to target, user@host with an optional port, checking
+// its host key against ~/.ssh/known_hosts. It authenticates with keyFile
+// if given, then with the keys in the local SSH agent, then with the
+// usual unencrypted keys in ~/.ssh.
+func dialRemote(target, keyFile string) (*remoteHost, error) {
+	login, addr, ok := strings.Cut(target, "@")
+	if !ok {
+		addr = target
+		u, err := user.Current()
+		if err != nil {
+			return nil, fmt.Errorf("no user in %q and the local one is unknown: %w", target, err)
+		}
+		login = u.Username
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(strings.Trim(addr, "[]"), "22")
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, fmt.Errorf("reading known hosts: %w; connect once with ssh to add the host key", err)
+	}
+	auth, err := sshAuth(keyFile, home)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            login,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+		Timeout:         sshTimeout,
+	})
+	if err != nil {
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) && len(keyErr.Want) == 0 {
+			return nil, fmt.Errorf("%s is not in known_hosts; connect once with ssh to add its host key", addr)
+		}
+		return nil, err
+	}
+	return &remoteHost{name: target, client: client}, nil
+}
+
+// sshAuth returns the authentication methods dialRemote tries, in order.
+func sshAuth(keyFile, home string) ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+	if keyFile != "" {
+		signer, err := readKey(keyFile, true)
+		if err != nil {
+			return nil, fmt.Errorf("-ssh-key: %w", err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	if keyFile == "" {
+		var signers []ssh.Signer
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			// Keys that are missing or need a passphrase are skipped;
+			// name them with -ssh-key to be asked for it.
+			if signer, err := readKey(filepath.Join(home, ".ssh", name), false); err == nil {
+				signers = append(signers, signer)
+			}
+		}
+		if len(signers) > 0 {
+			methods = append(methods, ssh.PublicKeys(signers...))
+		}
+	}
+	if len(methods) == 0 {
+		return nil, errors.New("no SSH agent or key to log in with; start ssh-agent or give -ssh-key")
+	}
+	return methods, nil
+}
+
+// readKey parses a private key file, asking on the terminal for the
+// passphrase of an encrypted one if ask is set.
+func readKey(path string, ask bool) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) || !ask {
+		return signer, err
+	}
+	fmt.Fprintf(os.Stderr, "Passphrase for %s: ", path)
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKeyWithPassphrase(data, passphrase)
+}
+
+// listInterfaces lists the interfaces of the monitored host.
+func listInterfaces() ([]net.Interface, error) {
+	if remote != nil {
+		return remote.interfaces()
+	}
+	return net.Interfaces()
+}
+
+// readCounters reads the per-interface counters of the monitored host.
+func readCounters() ([]psnet.IOCountersStat, error) {
+	if remote != nil {
+		return remote.counters()
+	}
+	return psnet.IOCounters(true)
+}
+
+// run runs cmd on the host and returns its output.
+func (r *remoteHost) run(cmd string) (string, error) {
+	session, err := r.client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", r.name, err)
+	}
+	defer session.Close()
+	out, err := session.Output(cmd)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s: %w", r.name, cmd, err)
+	}
+	return string(out), nil
+}
+
+// counters reads the host's per-interface counters.
+func (r *remoteHost) counters() ([]psnet.IOCountersStat, error) {
+	out, err := r.run(remoteCountersCmd)
+	if err != nil {
+		return nil, err
+	}
+	return parseProcNetDev(out)
+}
+
+// interfaces lists the host's interfaces. Only the name, flags, MTU and
+// hardware address are filled in. The index is left zero so the
+// interfaces never match one of this machine's.
+func (r *remoteHost) interfaces() ([]net.Interface, error) {
+	out, err := r.run(remoteIfacesCmd)
+	if err != nil {
+		return nil, err
+	}
+	var interfaces []net.Interface
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		iface := net.Interface{Name: fields[0]}
+		if flags, err := strconv.ParseUint(strings.TrimPrefix(fields[1], "0x"), 16, 32); err == nil {
+			iface.Flags = linuxFlags(flags)
+		}
+		iface.MTU, _ = strconv.Atoi(fields[2])
+		if len(fields) > 3 {
+			iface.HardwareAddr, _ = net.ParseMAC(fields[3])
+		}
+		interfaces = append(interfaces, iface)
+	}
+	return interfaces, nil
+}
+
+// linuxFlags converts the IFF_ flags in /sys/class/net/*/flags.
+func linuxFlags(iff uint64) net.Flags {
+	var flags net.Flags
+	for bit, flag := range map[uint64]net.Flags{
+		0x1:    net.FlagUp,
+		0x2:    net.FlagBroadcast,
+		0x8:    net.FlagLoopback,
+		0x10:   net.FlagPointToPoint,
+		0x40:   net.FlagRunning,
+		0x1000: net.FlagMulticast,
+	} {
+		if iff&bit != 0 {
+			flags |= flag
+		}
+	}
+	return flags
+}
+
+// primary returns the interface of the host's default route with the
+// lowest metric, or "" if it has none.
+func (r *remoteHost) primary() string {
+	out, err := r.run(remoteRouteCmd)
+	if err != nil {
+		return ""
+	}
+	name, best := "", -1
+	for _, line := range strings.Split(out, "\n") {
+		// Iface Destination Gateway Flags RefCnt Use Metric Mask ...
+		fields := strings.Fields(line)
+		if len(fields) < 8 || fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+		if metric, err := strconv.Atoi(fields[6]); err == nil && (best < 0 || metric < best) {
+			name, best = fields[0], metric
+		}
+	}
+	return name
+}
+
+// parseProcNetDev parses the counters in /proc/net/dev, skipping its two
+// header lines.
+func parseProcNetDev(data string) ([]psnet.IOCountersStat, error) {
+	var stats []psnet.IOCountersStat
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for line := 0; scanner.Scan(); line++ {
+		if line < 2 {
+			continue
+		}
+		name, rest, ok := strings.Cut(scanner.Text(), ":")
+		fields := strings.Fields(rest)
+		if !ok || len(fields) < 16 {
+			return nil, fmt.Errorf("unexpected /proc/net/dev line %q", scanner.Text())
+		}
+		var n [16]uint64
+		for i := range n {
+			v, err := strconv.ParseUint(fields[i], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected /proc/net/dev line %q", scanner.Text())
+			}
+			n[i] = v
+		}
+		// Receive: bytes packets errs drop fifo frame compressed multicast,
+		// then the same for transmit with colls and carrier.
+		stats = append(stats, psnet.IOCountersStat{
+			Name:      strings.TrimSpace(name),
+			BytesRecv: n[0], PacketsRecv: n[1], Errin: n[2], Dropin: n[3], Fifoin: n[4],
+			BytesSent: n[8], PacketsSent: n[9], Errout: n[10], Dropout: n[11], Fifoout: n[12],
+		})
+	}
+	return stats, scanner.Err()
+}
+
+// closeRemote closes the connection to the -remote host, if any.
+func closeRemote() {
+	if remote != nil {
+		remote.client.Close()
+	}
+}
+
+// exit closes the -remote connection and exits with code. main exits
+// through it rather than os.Exit, which skips deferred calls.
+func exit(code int) {
+	closeRemote()
+	os.Exit(code)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"clifs/shared/units"
+)
+
+// ifaceTotals is what one interface moved this session.
+type ifaceTotals struct {
+	Sent, Recv         uint64  // bytes
+	PeakSent, PeakRecv float64 // highest rates seen, bytes per second
+}
+
+// summaryJSON is the -json form of the summary printed on quit.
+type summaryJSON struct {
+	Seconds    float64                     `json:"duration_seconds"`
+	Sent       uint64                      `json:"sent_bytes"`
+	Recv       uint64                      `json:"recv_bytes"`
+	Interfaces map[string]ifaceSummaryJSON `json:"interfaces"`
+}
+
+type ifaceSummaryJSON struct {
+	Sent     uint64  `json:"sent_bytes"`
+	Recv     uint64  `json:"recv_bytes"`
+	AvgSent  float64 `json:"avg_sent_bytes_per_sec"`
+	AvgRecv  float64 `json:"avg_recv_bytes_per_sec"`
+	PeakSent float64 `json:"peak_sent_bytes_per_sec"`
+	PeakRecv float64 `json:"peak_recv_bytes_per_sec"`
+}
+
+// writeSummary prints the bytes moved since start, in total and for each
+// interface that moved any, with each interface's average and peak rates.
+func (m Model) writeSummary(w io.Writer, now time.Time, asJSON bool) error {
+	elapsed := now.Sub(m.started)
+	names := make([]string, 0, len(m.sessionByIface))
+	for name, t := range m.sessionByIface {
+		if t.Sent+t.Recv > 0 {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	avg := func(bytes uint64) float64 {
+		if elapsed <= 0 {
+			return 0
+		}
+		return float64(bytes) / elapsed.Seconds()
+	}
+
+	if asJSON {
+		out := summaryJSON{Seconds: elapsed.Seconds(), Sent: m.sessionSent, Recv: m.sessionRecv,
+			Interfaces: make(map[string]ifaceSummaryJSON, len(names))}
+		for _, name := range names {
+			t := m.sessionByIface[name]
+			out.Interfaces[name] = ifaceSummaryJSON{Sent: t.Sent, Recv: t.Recv,
+				AvgSent: avg(t.Sent), AvgRecv: avg(t.Recv), PeakSent: t.PeakSent, PeakRecv: t.PeakRecv}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+
+	if _, err := fmt.Fprintf(w, "Session of %s: sent %s, received %s\n", elapsed.Round(time.Second),
+		units.Bytes(float64(m.sessionSent)), units.Bytes(float64(m.sessionRecv))); err != nil {
+		return err
+	}
+	for _, name := range names {
+		t := m.sessionByIface[name]
+		if _, err := fmt.Fprintf(w, "  %-10s sent %s, received %s · avg ↑ %s ↓ %s · peak ↑ %s ↓ %s\n", name,
+			units.Bytes(float64(t.Sent)), units.Bytes(float64(t.Recv)),
+			m.formatRate(avg(t.Sent)), m.formatRate(avg(t.Recv)), m.formatRate(t.PeakSent), m.formatRate(t.PeakRecv)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
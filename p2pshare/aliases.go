@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// aliasPath returns ~/.config/clifs/peers.json, where peer aliases are kept.
+func aliasPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "clifs", "peers.json"), nil
+}
+
+// loadAliases reads the saved aliases, keyed by peerID. A missing file is
+// not an error.
+func loadAliases() (map[string]string, error) {
+	aliases := map[string]string{}
+	path, err := aliasPath()
+	if err != nil {
+		return aliases, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return aliases, nil
+	}
+	if err != nil {
+		return aliases, err
+	}
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		return map[string]string{}, err
+	}
+	return aliases, nil
+}
+
+// saveAliases writes the aliases, replacing the file atomically.
+func saveAliases(aliases map[string]string) error {
+	path, err := aliasPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(aliases, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// peerID is the stable key a peer's alias is saved under: its hostname when
+// it announced one, since addresses change with DHCP, otherwise its IP.
+func peerID(addr, hostname string) string {
+	if hostname != "" {
+		return "host:" + hostname
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return "ip:" + host
+	}
+	return "ip:" + addr
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// binding is the local interface chosen with -bind.
+type binding struct {
+	iface *net.Interface
+	addr  *net.IPNet // the interface's IPv4 address and subnet, nil if it has none
+}
+
+// bound is the -bind choice, or nil to use every interface.
+var bound *binding
+
+// ipVersion selects the IP versions used for discovery and transfers,
+// "v4", "v6" or "both", set by -ip.
+var ipVersion = "v4"
+
+func useIPv4() bool { return ipVersion != "v6" }
+func useIPv6() bool { return ipVersion != "v4" }
+
+// resolveBind finds the interface named by spec, which may be an interface
+// name such as eth0 or one of its addresses.
+func resolveBind(spec string) (*binding, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var candidates []string
+	for i := range interfaces {
+		iface := &interfaces[i]
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		var v4 *net.IPNet
+		matched := spec == iface.Name
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			isV4 := ipnet.IP.To4() != nil
+			if spec == ipnet.IP.String() {
+				matched = true
+				if isV4 {
+					v4 = ipnet
+				}
+			}
+			if isV4 && v4 == nil {
+				v4 = ipnet
+			}
+			if isV4 && useIPv4() || !isV4 && useIPv6() {
+				candidates = append(candidates, fmt.Sprintf("%s (%s)", iface.Name, ipnet.IP))
+			}
+		}
+		if matched {
+			return &binding{iface: iface, addr: v4}, nil
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no interface %q, and no interfaces are up", spec)
+	}
+	return nil, fmt.Errorf("no interface %q; choose one of %s", spec, strings.Join(candidates, ", "))
+}
+
+// broadcast is the directed broadcast address of the bound subnet, which
+// the OS routes out of that interface rather than the default one.
+func (b *binding) broadcast() net.IP {
+	ip := b.addr.IP.To4()
+	mask := b.addr.Mask
+	if len(mask) == net.IPv6len {
+		mask = mask[12:]
+	}
+	out := make(net.IP, net.IPv4len)
+	for i := range out {
+		out[i] = ip[i] | ^mask[i]
+	}
+	return out
+}
+
+// listenAddrs are the addresses servers listen on for port: every
+// interface, or with -bind the bound interface's addresses of the enabled
+// IP versions.
+func listenAddrs(port string) []string {
+	if bound == nil {
+		return []string{net.JoinHostPort("", port)}
+	}
+	var hosts []string
+	if useIPv4() && bound.addr != nil {
+		hosts = append(hosts, bound.addr.IP.String())
+	}
+	if useIPv6() {
+		addrs, _ := bound.iface.Addrs()
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok || ipnet.IP.To4() != nil {
+				continue
+			}
+			host := ipnet.IP.String()
+			if ipnet.IP.IsLinkLocalUnicast() {
+				host += "%" + bound.iface.Name
+			}
+			hosts = append(hosts, host)
+		}
+	}
+	addrs := make([]string, len(hosts))
+	for i, host := range hosts {
+		addrs[i] = net.JoinHostPort(host, port)
+	}
+	return addrs
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Streamed transfers carry a SHA-256 digest of the file, so the receiver
+// can tell a damaged or truncated file from a good one before saving it.
+//
+// The sender offers the digest by setting header.Checksum to
+// checksumSHA256 and the receiver agrees by setting reply.Checksum. The
+// sender then follows the file's bytes with a trailer line holding the
+// digest, and the receiver, once it has checked the digest and saved the
+// file, answers with a reply saying whether both went well. A peer that
+// does not know the fields leaves them out and the file is streamed as
+// before. Chunked transfers check each chunk instead; see chunks.go.
+
+// checksumSHA256 is the digest algorithm streamed transfers use.
+const checksumSHA256 = "sha256"
+
+// trailer follows the file's bytes when the receiver agreed to check the
+// digest, encoded as one line of JSON.
+type trailer struct {
+	SHA256 string `json:"sha256"` // hex digest of the whole file
+}
+
+// finishChecked sends the digest of the file just sent and waits for the
+// receiver to confirm that it matched and the file was saved.
+func finishChecked(conn io.Writer, r *bufio.Reader, sum []byte) error {
+	if err := json.NewEncoder(conn).Encode(trailer{SHA256: hex.EncodeToString(sum)}); err != nil {
+		return fmt.Errorf("sending checksum: %w", err)
+	}
+	verdict, err := readReply(r)
+	if err != nil {
+		return fmt.Errorf("waiting for peer to verify the file: %w", err)
+	}
+	if !verdict.OK {
+		return fmt.Errorf("peer rejected the file: %s", verdict.Error)
+	}
+	return nil
+}
+
+// checkTrailer reads the sender's digest and compares it with sum, the
+// digest of the bytes received.
+func checkTrailer(r *bufio.Reader, sum []byte) error {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return fmt.Errorf("reading checksum: %w", err)
+	}
+	var t trailer
+	if err := json.Unmarshal(line, &t); err != nil {
+		return fmt.Errorf("invalid checksum: %w", err)
+	}
+	if got := hex.EncodeToString(sum); t.SHA256 != got {
+		return fmt.Errorf("checksum mismatch: received data has sha256 %s, sender's file has %s", got, t.SHA256)
+	}
+	return nil
+}
+
+// sendVerdict tells the sender whether the checked file was saved, err
+// being why not.
+func sendVerdict(conn io.Writer, err error) {
+	verdict := reply{OK: true}
+	if err != nil {
+		verdict = reply{Error: err.Error()}
+	}
+	json.NewEncoder(conn).Encode(verdict)
+}
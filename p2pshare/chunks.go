@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Chunked transfers, chosen with -chunked, send the file as fixed-size
+// chunks that each carry a checksum, so a chunk damaged on the way is sent
+// again on its own instead of the whole file failing.
+//
+// The sender sets header.Chunk to the chunk size and the receiver agrees
+// by setting reply.Chunked; a receiver that does not, such as an older one
+// or one writing to stdout, gets the file streamed as usual. Each chunk is
+// then sent as a chunkFrame line followed by the chunk's bytes, in
+// index order, the last one short. Once a round of chunks is through, the
+// receiver answers with a resendRequest listing the chunks that failed
+// their checksum, and the sender sends just those as the next round. An
+// empty list ends the transfer.
+
+// chunkSize is the chunk size a chunked send uses.
+const chunkSize = 4 << 20
+
+// maxChunkSize is the largest chunk a receiver accepts, so a sender
+// cannot make it allocate without bound.
+const maxChunkSize = 64 << 20
+
+// maxResendRounds is how many times the receiver asks for failed chunks
+// before giving up on the file.
+const maxResendRounds = 3
+
+// chunkedSend is whether sends are chunked, set by -chunked.
+var chunkedSend = false
+
+// chunkTable is the CRC-32C table chunk checksums use.
+var chunkTable = crc32.MakeTable(crc32.Castagnoli)
+
+// chunkFrame precedes each chunk's bytes, encoded as one line of JSON.
+type chunkFrame struct {
+	Index int64  `json:"index"`
+	CRC   uint32 `json:"crc32c"`
+}
+
+// resendRequest is the receiver's answer to a round of chunks, encoded as
+// one line of JSON. Error is set when the receiver gives up.
+type resendRequest struct {
+	Resend []int64 `json:"resend"`
+	Error  string  `json:"error,omitempty"`
+}
+
+// chunkSpan returns the offset and length of chunk index of a file of the
+// given size.
+func chunkSpan(index, size, chunk int64) (offset, length int64) {
+	offset = index * chunk
+	return offset, min(chunk, size-offset)
+}
+
+// numChunks is how many chunks a file of the given size splits into.
+func numChunks(size, chunk int64) int64 {
+	return (size + chunk - 1) / chunk
+}
+
+// sendChunks sends file in chunks over conn, reading the receiver's
+// resend requests from r, until every chunk has arrived intact. Progress
+// follows the first round; resent chunks do not move it.
+func sendChunks(ctx context.Context, conn io.Writer, r *bufio.Reader, file *os.File, size int64, progress progressFunc) error {
+	indices := make([]int64, numChunks(size, chunkSize))
+	for i := range indices {
+		indices[i] = int64(i)
+	}
+	first := &progressReader{r: newLimitedReader(ctx, ctxReader{ctx: ctx, r: file}, sendLimit), total: size, report: progress}
+	buf := make([]byte, chunkSize)
+	w := bufio.NewWriter(conn)
+	for round := 0; ; round++ {
+		for _, index := range indices {
+			offset, length := chunkSpan(index, size, chunkSize)
+			var src io.Reader = first
+			if round > 0 {
+				src = newLimitedReader(ctx, ctxReader{ctx: ctx, r: io.NewSectionReader(file, offset, length)}, sendLimit)
+			}
+			data := buf[:length]
+			if _, err := io.ReadFull(src, data); err != nil {
+				return fmt.Errorf("reading file: %w", err)
+			}
+			if err := json.NewEncoder(w).Encode(chunkFrame{Index: index, CRC: crc32.Checksum(data, chunkTable)}); err != nil {
+				return fmt.Errorf("sending file: %w", err)
+			}
+			if _, err := w.Write(data); err != nil {
+				return fmt.Errorf("sending file: %w", err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return fmt.Errorf("sending file: %w", err)
+		}
+		if round == 0 && progress != nil {
+			progress(size, size)
+		}
+
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return fmt.Errorf("waiting for peer to check chunks: %w", err)
+		}
+		var req resendRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			return fmt.Errorf("invalid resend request: %w", err)
+		}
+		if req.Error != "" {
+			return fmt.Errorf("peer gave up: %s", req.Error)
+		}
+		if len(req.Resend) == 0 {
+			return nil
+		}
+		for _, index := range req.Resend {
+			if index < 0 || index >= numChunks(size, chunkSize) {
+				return fmt.Errorf("invalid resend request: no chunk %d", index)
+			}
+		}
+		indices = req.Resend
+	}
+}
+
+// receiveChunks reads a chunked file from r into file, asking over conn
+// for the chunks that fail their checksum to be sent again. It returns
+// how many bytes arrived intact.
+func receiveChunks(conn io.Writer, r *bufio.Reader, file *os.File, h header) (int64, error) {
+	count := numChunks(h.Size, h.Chunk)
+	want := make([]int64, count)
+	for i := range want {
+		want[i] = int64(i)
+	}
+	buf := make([]byte, h.Chunk)
+	var done int64
+	for round := 0; ; round++ {
+		var failed []int64
+		for _, index := range want {
+			line, err := r.ReadBytes('\n')
+			if err != nil {
+				return done, err
+			}
+			var frame chunkFrame
+			if err := json.Unmarshal(line, &frame); err != nil {
+				return done, fmt.Errorf("invalid chunk header: %w", err)
+			}
+			if frame.Index != index {
+				return done, fmt.Errorf("got chunk %d, want %d", frame.Index, index)
+			}
+			offset, length := chunkSpan(index, h.Size, h.Chunk)
+			data := buf[:length]
+			if _, err := io.ReadFull(r, data); err != nil {
+				return done, err
+			}
+			if crc32.Checksum(data, chunkTable) != frame.CRC {
+				failed = append(failed, index)
+				continue
+			}
+			if _, err := file.WriteAt(data, offset); err != nil {
+				return done, err
+			}
+			done += length
+		}
+
+		req := resendRequest{Resend: failed}
+		var gaveUp error
+		if len(failed) > 0 && round == maxResendRounds {
+			gaveUp = fmt.Errorf("%d chunks still damaged after %d resends", len(failed), maxResendRounds)
+			req = resendRequest{Error: gaveUp.Error()}
+		}
+		if err := json.NewEncoder(conn).Encode(req); err != nil {
+			return done, err
+		}
+		if gaveUp != nil {
+			return done, gaveUp
+		}
+		if len(failed) == 0 {
+			return done, nil
+		}
+		want = failed
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"clifs/shared/units"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// usageError is a mistake in the command line, reported with exit code 2.
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string { return e.msg }
+
+// runCommand runs the subcommand named by args[0].
+func runCommand(args []string) error {
+	switch args[0] {
+	case "send":
+		return runSend(args[1:])
+	case "receive":
+		// -stdout is also accepted after the command, where it reads
+		// naturally: p2pshare receive --stdout | tar xf -
+		receive := flag.NewFlagSet("receive", flag.ContinueOnError)
+		receive.SetOutput(io.Discard)
+		receive.BoolVar(stdoutFlag, "stdout", *stdoutFlag, stdoutUsage)
+		if err := receive.Parse(args[1:]); err != nil || receive.NArg() > 0 {
+			return usageError{"usage: p2pshare [flags] receive [-stdout]"}
+		}
+		return runReceive()
+	}
+	return usageError{fmt.Sprintf("unknown command %q; usage: p2pshare [flags] [send <file> <peer> | receive]", args[0])}
+}
+
+// runSend sends a file to a peer without the TUI, printing progress to
+// stdout. The peer is an address, with or without a port; discovery is
+// skipped. Ctrl+C cancels the transfer.
+func runSend(args []string) error {
+	if len(args) != 2 {
+		return usageError{"usage: p2pshare [flags] send <file> <peer>"}
+	}
+	if *stdoutFlag {
+		return usageError{"-stdout only works when receiving"}
+	}
+	filename := args[0]
+	peer, err := parsePeerAddr(args[1])
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	t := &outgoing{name: filename, peer: peer}
+	elapsed, err := sendFile(ctx, filename, peer, func(done, total int64) {
+		t.observe(time.Now(), done, total)
+		fmt.Printf("\r%s", t.view())
+	})
+	if t.total > 0 {
+		fmt.Println()
+	}
+	result := transferResultMsg{sent: true, name: filename, peer: peer, size: t.total, elapsed: elapsed, err: err}
+	if !errors.Is(err, errCancelled) {
+		notifyNow(result)
+	}
+	if err != nil {
+		return err
+	}
+	note := ""
+	if simulate {
+		note = simulatedNote
+	}
+	fmt.Printf("Sent %s (%s) to %s %s%s\n", filepath.Base(filename), units.Bytes(float64(t.total)), peer, result.pace(), note)
+	return nil
+}
+
+// runReceive accepts files into the download directory without the TUI,
+// logging each transfer to stdout. Ctrl+C stops accepting new transfers and
+// waits for those in progress; a second Ctrl+C aborts them.
+func runReceive() error {
+	if conflictPolicy == conflictPrompt {
+		return usageError{"-on-conflict=prompt needs the interactive UI; use overwrite, rename or skip"}
+	}
+	if askName {
+		return usageError{"-ask-name needs the interactive UI"}
+	}
+	if simulate {
+		return usageError{"-simulate only applies to sending"}
+	}
+	// With -stdout the file contents own stdout, so the log goes to stderr.
+	toStdout = *stdoutFlag
+	log := os.Stdout
+	if toStdout {
+		log = os.Stderr
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	// Restore the default handler once stopping so a second Ctrl+C exits.
+	context.AfterFunc(ctx, stop)
+
+	err := serve(ctx, func(msg tea.Msg) {
+		stamp := time.Now().Format("15:04:05")
+		switch msg := msg.(type) {
+		case serverUpMsg:
+			into := downloadDir
+			if toStdout {
+				into = "stdout"
+			}
+			fmt.Fprintf(log, "Receiving files into %s on %s (Ctrl+C to stop)\n", into, strings.Join(msg.addrs, ", "))
+		case streamStartMsg:
+			fmt.Fprintf(log, "%s  incoming %s (%s) from %s\n", stamp, msg.name, units.Bytes(float64(msg.size)), msg.peer)
+		case transferResultMsg:
+			go notifyNow(msg)
+			if msg.err != nil {
+				fmt.Fprintf(log, "%s  failed   %s from %s: %v\n", stamp, msg.name, msg.peer, msg.err)
+				return
+			}
+			fmt.Fprintf(log, "%s  received %s (%s) from %s %s\n",
+				stamp, msg.name, units.Bytes(float64(msg.size)), msg.peer, msg.pace())
+		}
+	})
+	if err == nil {
+		fmt.Fprintln(log, "Stopped receiving")
+	}
+	return err
+}
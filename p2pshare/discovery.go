@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	discoverMessage = "DISCOVER_PEER"
+	responseMessage = "PEER_RESPONSE"
+)
+
+// discoveryPort is the UDP port announcements are sent to and answered
+// on, set by -discovery-port.
+var discoveryPort = 9876
+
+// discoveryWindow is how long discovery listens for responses, set by
+// -discovery-window.
+var discoveryWindow = 2 * time.Second
+
+// discoveryBufSize is the largest discovery datagram read, which leaves
+// room for responses to grow beyond a hostname.
+const discoveryBufSize = 8192
+
+// discoveryTickInterval is how often the elapsed search time is redrawn.
+const discoveryTickInterval = 100 * time.Millisecond
+
+// multicastGroup is the IPv4 group joined for multicast discovery.
+var multicastGroup = net.IPv4(239, 255, 98, 76)
+
+// multicastGroup6 is the link-local IPv6 group used for discovery. IPv6 has
+// no broadcast, so it is always used with -ip v6 or both.
+var multicastGroup6 = net.ParseIP("ff02::c1f5")
+
+// discoveryMode is "broadcast" or "multicast", set by -discovery.
+var discoveryMode = "broadcast"
+
+// discoverySocket is a socket discovery listens on, with the address
+// announcements are sent to.
+type discoverySocket struct {
+	conn      net.PacketConn
+	target    net.Addr
+	multicast bool // bound to a multicast group, so replies go to the group too
+	// searchOnly is set when the discovery port was taken, so the socket
+	// is on a spare port: it hears replies to its own announcement but not
+	// the announcements of other peers.
+	searchOnly bool
+}
+
+// openDiscovery opens a discovery socket for each IP version in use. With
+// both versions, one failing to open is tolerated as long as the other
+// opens.
+func openDiscovery() ([]discoverySocket, error) {
+	var sockets []discoverySocket
+	var firstErr error
+	open := func(open func() (discoverySocket, error)) {
+		s, err := open()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return
+		}
+		sockets = append(sockets, s)
+	}
+	if useIPv4() {
+		open(openDiscovery4)
+	}
+	if useIPv6() {
+		open(openDiscovery6)
+	}
+	if len(sockets) == 0 {
+		return nil, firstErr
+	}
+	return sockets, nil
+}
+
+// openDiscovery4 opens the IPv4 discovery socket for discoveryMode. For
+// multicast the socket joins multicastGroup; closing it leaves the group.
+//
+// With -bind the group is joined on, or the broadcast directed to, the
+// bound interface only. The broadcast socket still listens on every
+// address: on Linux a socket bound to a unicast address never receives
+// broadcasts, so it could not answer other peers.
+func openDiscovery4() (discoverySocket, error) {
+	if bound != nil && bound.addr == nil {
+		return discoverySocket{}, fmt.Errorf("%s has no IPv4 address", bound.iface.Name)
+	}
+	if discoveryMode == "multicast" {
+		var iface *net.Interface
+		if bound != nil {
+			iface = bound.iface
+		}
+		group := &net.UDPAddr{IP: multicastGroup, Port: discoveryPort}
+		conn, err := net.ListenMulticastUDP("udp4", iface, group)
+		if err != nil {
+			return discoverySocket{}, err
+		}
+		return discoverySocket{conn: conn, target: group, multicast: true}, nil
+	}
+	// Multicast sockets share their port, but only one broadcast socket
+	// can have it, such as when two instances run on one machine. The
+	// second one falls back to searching from a spare port rather than to
+	// listening only: with the port taken it cannot hear announcements
+	// anyway, but broadcasting from elsewhere still gets replies. Other
+	// peers cannot discover it, which the UI warns about, though they can
+	// still add it by address.
+	conn, err := net.ListenPacket("udp4", net.JoinHostPort("", strconv.Itoa(discoveryPort)))
+	searchOnly := errors.Is(err, syscall.EADDRINUSE)
+	if searchOnly {
+		conn, err = net.ListenPacket("udp4", ":0")
+	}
+	if err != nil {
+		return discoverySocket{}, err
+	}
+	target := net.IPv4bcast
+	if bound != nil {
+		target = bound.broadcast()
+	}
+	return discoverySocket{conn: conn, target: &net.UDPAddr{IP: target, Port: discoveryPort}, searchOnly: searchOnly}, nil
+}
+
+// openDiscovery6 joins multicastGroup6 on the bound interface, or the
+// first one that can carry IPv6 multicast. Link-local groups are scoped
+// to one interface, so the target names it as its zone.
+func openDiscovery6() (discoverySocket, error) {
+	iface, err := multicastInterface6()
+	if err != nil {
+		return discoverySocket{}, err
+	}
+	conn, err := net.ListenMulticastUDP("udp6", iface, &net.UDPAddr{IP: multicastGroup6, Port: discoveryPort})
+	if err != nil {
+		return discoverySocket{}, err
+	}
+	target := &net.UDPAddr{IP: multicastGroup6, Port: discoveryPort, Zone: iface.Name}
+	return discoverySocket{conn: conn, target: target, multicast: true}, nil
+}
+
+// multicastInterface6 returns the bound interface, or the first interface
+// that is up, supports multicast, is not loopback and has an IPv6 address.
+func multicastInterface6() (*net.Interface, error) {
+	if bound != nil {
+		return bound.iface, nil
+	}
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for i := range interfaces {
+		iface := &interfaces[i]
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.To4() == nil {
+				return iface, nil
+			}
+		}
+	}
+	return nil, errors.New("no IPv6 multicast interface is up")
+}
+
+// peersMsg lists the peers that answered discovery, with the hostnames
+// they announced keyed by address.
+type peersMsg struct {
+	peers     []string
+	hostnames map[string]string
+}
+
+// discoveryErrMsg ends a search that could not run, such as when no
+// network is up. It is retried after discoveryRetry.
+type discoveryErrMsg struct{ err error }
+
+// discoveryRetry is how long to wait before searching again after a
+// failure.
+const discoveryRetry = 5 * time.Second
+
+// discoveryRetryMsg starts the search again after a failure.
+type discoveryRetryMsg struct{}
+
+// searchOnlyMsg warns that discovery could not have its port, so other
+// peers cannot find this one.
+type searchOnlyMsg struct{}
+
+// peerFoundMsg reports a peer as soon as it answers, before the
+// discovery window closes.
+type peerFoundMsg struct {
+	addr     string
+	hostname string
+}
+
+// discoveryTickMsg redraws the elapsed and remaining time while discovery
+// runs.
+type discoveryTickMsg struct{}
+
+// discovery is a search for peers running in the background. Its events
+// are peerFoundMsg for each new peer, then a final peersMsg, or a
+// discoveryErrMsg if the search failed. A searchOnlyMsg may come first.
+type discovery struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	events  chan tea.Msg
+	started time.Time
+	window  time.Duration // how long the search listens for, fixed when it starts
+	found   int           // peers found so far
+}
+
+func newDiscovery() *discovery {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &discovery{ctx: ctx, cancel: cancel, events: make(chan tea.Msg, 16), started: time.Now(), window: discoveryWindow}
+}
+
+// progress describes how far the search has got, such as "searching 1.2s,
+// 0.8s left, 2 peers found so far".
+func (d *discovery) progress() string {
+	elapsed := time.Since(d.started)
+	s := fmt.Sprintf("searching %.1fs", elapsed.Seconds())
+	if left := d.window - elapsed; left > 0 {
+		s += fmt.Sprintf(", %.1fs left", left.Seconds())
+	} else {
+		s += ", finishing"
+	}
+	switch d.found {
+	case 0:
+	case 1:
+		s += ", 1 peer found so far"
+	default:
+		s += fmt.Sprintf(", %d peers found so far", d.found)
+	}
+	return s
+}
+
+// start returns the commands that run the search, deliver its events and
+// tick the elapsed and remaining time.
+func (d *discovery) start() tea.Cmd {
+	run := func() tea.Msg {
+		defer close(d.events)
+		msg, err := discoverPeers(d.ctx, func() {
+			d.events <- searchOnlyMsg{}
+		}, func(addr, hostname string) {
+			d.events <- peerFoundMsg{addr: addr, hostname: hostname}
+		})
+		if err != nil {
+			d.events <- discoveryErrMsg{err}
+		} else {
+			d.events <- msg
+		}
+		return nil
+	}
+	return tea.Batch(run, waitForTransfer(d.events), discoveryTick())
+}
+
+func discoveryTick() tea.Cmd {
+	return tea.Tick(discoveryTickInterval, func(time.Time) tea.Msg { return discoveryTickMsg{} })
+}
+
+// discoveryPacket is a datagram read from one of the discovery sockets.
+type discoveryPacket struct {
+	socket discoverySocket
+	text   string
+	from   net.Addr
+}
+
+// discoverPeers announces itself and collects replies for discoveryWindow
+// or until ctx is cancelled, calling found for each new peer. searchOnly
+// is called first if the search runs from a spare port. It fails if no
+// socket can be opened or the announcement cannot be sent.
+func discoverPeers(ctx context.Context, searchOnly func(), found func(addr, hostname string)) (peersMsg, error) {
+	sockets, err := openDiscovery()
+	if err != nil {
+		return peersMsg{}, err
+	}
+	for _, s := range sockets {
+		if s.searchOnly {
+			searchOnly()
+			break
+		}
+	}
+	closeAll := func() {
+		for _, s := range sockets {
+			s.conn.Close()
+		}
+	}
+	defer closeAll()
+	stop := context.AfterFunc(ctx, closeAll)
+	defer stop()
+
+	for _, s := range sockets {
+		if _, err := s.conn.WriteTo([]byte(discoverMessage), s.target); err != nil {
+			return peersMsg{}, fmt.Errorf("sending announcement: %w", err)
+		}
+	}
+
+	// Responses carry our hostname so peers can show and alias us by name,
+	// and the port we receive files on.
+	response := responseMessage
+	if hostname, err := os.Hostname(); err == nil {
+		response += " " + hostname
+	}
+	response += " port=" + transferPort
+
+	// Each socket is read on its own goroutine until the window closes or
+	// ctx closes the socket.
+	packets := make(chan discoveryPacket)
+	var readers sync.WaitGroup
+	deadline := time.Now().Add(discoveryWindow)
+	for _, s := range sockets {
+		s.conn.SetReadDeadline(deadline)
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			buf := make([]byte, discoveryBufSize)
+			for {
+				n, addr, err := s.conn.ReadFrom(buf)
+				if errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, net.ErrClosed) || ctx.Err() != nil {
+					return
+				}
+				if err != nil {
+					continue
+				}
+				packets <- discoveryPacket{socket: s, text: string(buf[:n]), from: addr}
+			}
+		}()
+	}
+	go func() {
+		readers.Wait()
+		close(packets)
+	}()
+
+	hostnames := make(map[string]string)
+	for p := range packets {
+		switch {
+		case p.text == discoverMessage:
+			// A socket bound to the multicast group cannot receive unicast
+			// replies, so multicast replies go to the group too.
+			reply := p.from
+			if p.socket.multicast {
+				reply = p.socket.target
+			}
+			p.socket.conn.WriteTo([]byte(response), reply)
+		case p.text == responseMessage || strings.HasPrefix(p.text, responseMessage+" "):
+			from := p.from.(*net.UDPAddr)
+			if bound != nil && bound.addr != nil && from.IP.To4() != nil && !bound.addr.Contains(from.IP) {
+				continue // a peer on another network
+			}
+			hostname, port := parseResponse(p.text)
+			host := from.IP.String()
+			if from.Zone != "" {
+				host += "%" + from.Zone
+			}
+			addr := net.JoinHostPort(host, port)
+			if _, seen := hostnames[addr]; seen {
+				continue
+			}
+			hostnames[addr] = hostname
+			found(addr, hostname)
+		}
+	}
+
+	msg := peersMsg{peers: []string{}, hostnames: hostnames}
+	for peer := range hostnames {
+		msg.peers = append(msg.peers, peer)
+	}
+
+	return msg, nil
+}
+
+// parseResponse returns the hostname and transfer port a peer announced
+// in its response. Older peers send the bare response, or only a
+// hostname, and receive on the default port.
+func parseResponse(text string) (hostname, port string) {
+	port = defaultTransferPort
+	var names []string
+	for _, field := range strings.Fields(strings.TrimPrefix(text, responseMessage)) {
+		if p, ok := strings.CutPrefix(field, "port="); ok {
+			if n, err := strconv.Atoi(p); err == nil && n >= 1 && n <= 65535 {
+				port = p
+			}
+			continue
+		}
+		names = append(names, field)
+	}
+	return strings.Join(names, " "), port
+}
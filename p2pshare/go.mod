@@ -3,9 +3,15 @@ module clifs
 go 1.23.5
 
 require (
-	github.com/aymanbagabas/go-osc52/v2 v2.0.1 // indirect
+	clifs/shared v0.0.0
 	github.com/charmbracelet/bubbletea v1.3.3 // direct
 	github.com/charmbracelet/lipgloss v1.0.0 // direct
+	golang.org/x/term v0.29.0
+	golang.org/x/time v0.10.0
+)
+
+require (
+	github.com/aymanbagabas/go-osc52/v2 v2.0.1 // indirect
 	github.com/charmbracelet/x/ansi v0.8.0 // indirect
 	github.com/charmbracelet/x/term v0.2.1 // indirect
 	github.com/erikgeiser/coninput v0.0.0-20211004153227-1c3628e74d0f // indirect
@@ -21,3 +27,5 @@ require (
 	golang.org/x/sys v0.30.0 // indirect
 	golang.org/x/text v0.3.8 // indirect
 )
+
+replace clifs/shared => ../shared
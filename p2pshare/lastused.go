@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+
+	"clifs/shared/state"
+)
+
+// lastStateName is the state file the most recent choice is saved to.
+const lastStateName = "p2pshare-last"
+
+// lastUsed is the peer, directory and file of the most recent send,
+// restored as the initial selection unless -remember=false is given.
+type lastUsed struct {
+	Peer   string `json:"peer"`    // peer address
+	PeerID string `json:"peer_id"` // peerID, which still matches if the address changes
+	Dir    string `json:"dir"`     // absolute directory the file was sent from
+	File   string `json:"file"`
+}
+
+// loadLastUsed returns the saved choice, or the zero value if there is
+// none.
+func loadLastUsed() lastUsed {
+	var last lastUsed
+	state.Load(lastStateName, &last)
+	return last
+}
+
+// saveLastUsed records a send of file, in the working directory, to peer.
+func saveLastUsed(peer, id, file string) error {
+	dir, err := filepath.Abs(".")
+	if err != nil {
+		return err
+	}
+	return state.Save(lastStateName, lastUsed{Peer: peer, PeerID: id, Dir: dir, File: file})
+}
+
+// chooseSendDir changes to the directory the file list shows: from when
+// given, and otherwise last, the directory of the most recent send, so the
+// list reopens where the user left off. last is skipped when -dir was
+// given, as the user picked where to work, and when it no longer exists.
+// Received files still go where -dir said, so downloadDir must be set
+// before calling this. restored is the directory changed to for last, or
+// "" if the working directory was kept or from was used.
+func chooseSendDir(from, last string, dirSet bool) (restored string, err error) {
+	if from != "" {
+		return "", os.Chdir(from)
+	}
+	if last == "" || dirSet {
+		return "", nil
+	}
+	if info, err := os.Stat(last); err != nil || !info.IsDir() {
+		return "", nil
+	}
+	if dir, err := filepath.Abs("."); err == nil && sameDir(dir, last) {
+		return "", nil
+	}
+	if err := os.Chdir(last); err != nil {
+		return "", nil // stay put, as if it were gone
+	}
+	return last, nil
+}
+
+// restoreLastPeer moves the cursor to the remembered peer once it has been
+// discovered, unless the user has already moved it.
+func (m model) restoreLastPeer() model {
+	if !m.restorePeer {
+		return m
+	}
+	for i, peer := range m.peers {
+		if peer == m.last.Peer || m.last.PeerID != "" && peerID(peer, m.hostnames[peer]) == m.last.PeerID {
+			m.selectedPeer = i
+			m.restorePeer = false
+			break
+		}
+	}
+	return m
+}
+
+// lastFileIndex is the row of the remembered file, if it was sent from the
+// working directory and is still there, and otherwise the first row.
+func (m model) lastFileIndex() int {
+	dir, err := filepath.Abs(".")
+	if err != nil || m.last.File == "" || !sameDir(dir, m.last.Dir) {
+		return 0
+	}
+	return max(slices.Index(m.files, m.last.File), 0)
+}
+
+// sameDir reports whether a and b name the same directory.
+func sameDir(a, b string) bool {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Stat(b)
+	return err == nil && os.SameFile(ai, bi)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"clifs/shared/notify"
+	"clifs/shared/units"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// notifyDesktop is whether finished transfers show a desktop notification,
+// set by -notify.
+var notifyDesktop = false
+
+// transferNotice returns the title and body of the notification about a
+// finished transfer.
+func transferNotice(msg transferResultMsg) (title, body string) {
+	name := filepath.Base(msg.name)
+	switch {
+	case msg.err != nil && msg.sent:
+		return "Send failed", fmt.Sprintf("%s to %s: %v", name, msg.peer, msg.err)
+	case msg.err != nil:
+		return "Receive failed", fmt.Sprintf("%s from %s: %v", name, msg.peer, msg.err)
+	case msg.sent:
+		return "File sent", fmt.Sprintf("%s (%s) to %s %s", name, units.Bytes(float64(msg.size)), msg.peer, msg.pace())
+	}
+	return "File received", fmt.Sprintf("%s (%s) from %s %s", name, units.Bytes(float64(msg.size)), msg.peer, msg.pace())
+}
+
+// notifyResult returns a command notifying about a finished transfer, or
+// nil. Failures and received files notify at once, but successful sends
+// wait for the queue to empty, so sending many files is one notification.
+// Errors showing it are ignored; the status line already has the news.
+func (m *model) notifyResult(msg transferResultMsg) tea.Cmd {
+	if !notifyDesktop {
+		return nil
+	}
+	title, body := transferNotice(msg)
+	if msg.sent && msg.err == nil {
+		m.sentSinceNotice++
+		if len(m.waiting()) > 0 {
+			return nil
+		}
+		if n := m.sentSinceNotice; n > 1 {
+			title, body = fmt.Sprintf("%d files sent", n), "the last was "+body
+		}
+		m.sentSinceNotice = 0
+	}
+	return func() tea.Msg {
+		notify.Send("p2pshare: "+title, body)
+		return nil
+	}
+}
+
+// notifyNow shows the notification about a finished transfer for the
+// send and receive commands, waiting until it is shown. Errors are
+// ignored, as the transfer itself is reported on the terminal.
+func notifyNow(msg transferResultMsg) {
+	if notifyDesktop {
+		title, body := transferNotice(msg)
+		notify.Send("p2pshare: "+title, body)
+	}
+}
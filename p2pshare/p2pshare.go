@@ -1,254 +1,1173 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
-	"net"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"clifs/shared/theme"
+	"clifs/shared/ui"
+	"clifs/shared/units"
+	"clifs/shared/version"
+
 	tea "github.com/charmbracelet/bubbletea"
 	lipgloss "github.com/charmbracelet/lipgloss"
+	"golang.org/x/term"
 )
 
 var (
-	titleStyle    = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FFB86C")).PaddingBottom(1)
-	peerStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("#50FA7B")).PaddingLeft(2)
-	statusStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("#8BE9FD")).Bold(true)
-	errorStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("#FF5555")).Bold(true)
-	footerStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("#6272A4")).PaddingTop(1)
-	selectedStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FF79C6"))
-	boxStyle      = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1, 2)
+	themeFlag     = flag.String("theme", "", "theme name (dark, light) or path to a theme file")
+	paletteFlag   = flag.String("palette", "", "colour override applied on top of the theme: colorblind")
+	versionFlag   = flag.Bool("version", false, "print version information and exit")
+	limitFlag     = flag.String("limit", "", "cap send bandwidth, e.g. 512KB or 5MB (per second); default unlimited")
+	portFlag      = flag.Int("port", 9000, "TCP port to receive files on; peers learn it through discovery")
+	discPortFlag  = flag.Int("discovery-port", discoveryPort, "UDP port for peer discovery; peers only find each other on the same one")
+	simulateFlag  = flag.Bool("simulate", false, "only pretend to send, with made-up progress and no connection, for demos and trying the UI; a simulated peer is listed")
+	notifyFlag    = flag.Bool("notify", false, "also show a desktop notification when a transfer completes or fails; a queue of sends notifies once it is done")
+	chunkedFlag   = flag.Bool("chunked", false, "send files in checksummed chunks so a damaged chunk is resent on its own; receivers without chunk support get the file streamed")
+	discoveryFlag = flag.String("discovery", "broadcast", "peer discovery transport: broadcast or multicast")
+	dirFlag       = flag.String("dir", ".", "directory received files are saved to")
+	fromFlag      = flag.String("from", "", "directory to list files to send from; default the one last sent from, with -remember and without -dir, and otherwise the working directory")
+	askNameFlag   = flag.Bool("ask-name", false, "ask what to save each incoming file as, suggesting the sender's name")
+	conflictFlag  = flag.String("on-conflict", conflictRename, "when a received file exists: prompt, overwrite, rename or skip")
+	rememberFlag  = flag.Bool("remember", true, "pre-select the last peer and file sent to, and save them after each send; -remember=false opts out")
+	ipFlag        = flag.String("ip", "v4", "IP versions to discover peers and receive files on: v4, v6 or both; IPv6 discovery always uses multicast")
+	bindFlag      = flag.String("bind", "", "interface name or address to discover peers and receive files on; default all")
+	inlineFlag    = flag.Bool("inline", false, "draw in place below the prompt, leaving the output in the scrollback, instead of using the whole screen")
+	stdoutFlag    = flag.Bool("stdout", false, stdoutUsage)
+	listenFlag    = flag.Bool("listen", false, "only receive files, without the interactive UI (same as the receive command)")
+	windowFlag    = flag.Duration("discovery-window", discoveryWindow, "how long to search for peers")
+	dialFlag      = flag.Duration("dial-timeout", dialTimeout, "how long to wait when connecting to a peer")
+	idleFlag      = flag.Duration("idle-timeout", idleTimeout, "drop a transfer after this long without data moving; 0 waits forever")
 )
 
+var (
+	titleStyle    lipgloss.Style
+	peerStyle     lipgloss.Style
+	statusStyle   lipgloss.Style
+	errorStyle    lipgloss.Style
+	footerStyle   lipgloss.Style
+	selectedStyle lipgloss.Style
+	boxStyle      lipgloss.Style
+)
+
+// applyTheme builds the styles from the palette.
+func applyTheme(p theme.Palette) {
+	titleStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(p.Accent)).PaddingBottom(1)
+	peerStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(p.Success)).PaddingLeft(2)
+	statusStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(p.Info)).Bold(true)
+	errorStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(p.Error)).Bold(true)
+	footerStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(p.Muted)).PaddingTop(1)
+	selectedStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(p.Selected))
+	boxStyle = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1, 2)
+}
+
 type model struct {
-	peers        []string
-	files        []string
-	selectedPeer int
-	selectedFile int
-	stage        string
-	status       string
+	peers           []string
+	files           []string
+	filesErr        error           // why the working directory could not be listed
+	noAccess        map[string]bool // listed files that cannot be opened, so cannot be sent
+	filesDir        string          // the remembered directory files are listed from; "" for the working directory
+	selectedPeer    int
+	selectedFile    int
+	stage           string
+	status          string
+	clickedRow      int // list row of the last mouse click, -1 if none
+	transfer        *outgoing
+	queue           []job         // sends in order: finished, then the active one, then waiting
+	sentSinceNotice int           // successful sends not yet notified about, with -notify
+	queueFocus      bool          // the keys reorder and remove waiting jobs
+	queueSel        int           // selected waiting job while the queue has the focus
+	confirmQuit     bool          // quit was requested during a transfer
+	conflicts       []conflictMsg // incoming files awaiting an overwrite/rename/skip answer
+	naming          []nameMsg     // incoming files awaiting a save name, with -ask-name
+	nameInput       string
+	nameInputErr    string              // why the last save name typed was rejected
+	history         []transferResultMsg // completed transfers this session, oldest first
+	showHistory     bool
+	compact         bool              // one line per transfer instead of a progress bar
+	probing         string            // peer being checked for liveness, if any
+	height          int               // terminal height, zero until the first WindowSizeMsg
+	hostnames       map[string]string // hostnames announced by peers, by address
+	aliases         map[string]string // user-chosen peer names, by peerID
+	renaming        bool              // editing the selected peer's alias
+	aliasInput      string
+	adding          bool // typing the address of a peer discovery did not find
+	peerInput       string
+	peerInputErr    string     // why the last address typed was rejected
+	discovery       *discovery // the running peer search, nil once it finishes
+	listening       []string   // addresses the receiving server listens on, once it is up
+	searchOnly      bool       // the discovery port was taken, so other peers cannot find this one
+	serverErr       error      // why the receiving server could not start
+	last            lastUsed   // the previous session's choice, if remembered
+	restorePeer     bool       // move the cursor to last.Peer when it is discovered
+}
+
+// maxHistory is the number of completed transfers remembered.
+const maxHistory = 50
+
+// historyRows is the number of transfers shown in the history panel.
+const historyRows = 8
+
+// etaWindow is how far back the ETA looks when estimating the rate, so it
+// reacts to speed changes.
+const etaWindow = 5 * time.Second
+
+// outgoing tracks the send in progress.
+type outgoing struct {
+	name      string
+	peer      string
+	done      int64
+	total     int64
+	samples   []progressSample
+	events    <-chan tea.Msg
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+// progressSample is the byte count seen at a point in time.
+type progressSample struct {
+	at   time.Time
+	done int64
+}
+
+// observe records progress, keeping samples within etaWindow.
+func (t *outgoing) observe(now time.Time, done, total int64) {
+	t.done, t.total = done, total
+	t.samples = append(t.samples, progressSample{at: now, done: done})
+	cutoff := now.Add(-etaWindow)
+	for len(t.samples) > 2 && t.samples[0].at.Before(cutoff) {
+		t.samples = t.samples[1:]
+	}
+}
+
+// rate returns the recent transfer rate in bytes per second.
+func (t *outgoing) rate() float64 {
+	if len(t.samples) < 2 {
+		return 0
+	}
+	first, last := t.samples[0], t.samples[len(t.samples)-1]
+	elapsed := last.at.Sub(first.at).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(last.done-first.done) / elapsed
+}
+
+// eta formats the estimated time remaining as ETA mm:ss.
+func (t *outgoing) eta() string {
+	rate := t.rate()
+	if rate <= 0 {
+		return "ETA --:--"
+	}
+	secs := int(float64(t.total-t.done)/rate + 0.5)
+	return fmt.Sprintf("ETA %02d:%02d", secs/60, secs%60)
+}
+
+// startSend runs the transfer in the background and returns a command
+// that delivers its progress and result.
+func startSend(filename, peer string) (*outgoing, tea.Cmd) {
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan tea.Msg)
+	go func() {
+		defer close(events)
+		defer cancel()
+		var size int64
+		elapsed, err := sendFile(ctx, filename, peer, func(done, total int64) {
+			size = total
+			events <- progressMsg{done: done, total: total}
+		})
+		events <- transferResultMsg{
+			sent:    true,
+			name:    filename,
+			peer:    peer,
+			size:    size,
+			elapsed: elapsed,
+			err:     err,
+		}
+	}()
+	t := &outgoing{name: filename, peer: peer, events: events, cancel: cancel}
+	return t, waitForTransfer(events)
+}
+
+// waitForTransfer delivers the next event from a running transfer.
+func waitForTransfer(events <-chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		msg, ok := <-events
+		if !ok {
+			return nil
+		}
+		return msg
+	}
 }
 
 func initialModel() model {
-	return model{
+	files, noAccess, err := getFiles()
+	m := model{
 		peers:        []string{},
-		files:        getFiles(),
+		files:        files,
+		filesErr:     err,
+		noAccess:     noAccess,
 		selectedPeer: 0,
 		selectedFile: 0,
 		stage:        "peers",
 		status:       "🔍 Searching for peers...",
+		clickedRow:   -1,
+		aliases:      map[string]string{},
+		hostnames:    map[string]string{},
+		discovery:    newDiscovery(),
+	}
+	if simulate {
+		m.peers = append(m.peers, simulatedPeer)
+		m.hostnames[simulatedPeer] = "simulated peer"
+		m.status = "🧪 Sends are simulated; pick any peer to try one"
 	}
+	return m
 }
 
 func (m model) Init() tea.Cmd {
-	return discoverPeers
+	return m.discovery.start()
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	next, cmd := m.update(msg)
+	if m, ok := next.(model); ok {
+		next = m.clampSelections()
+	}
+	return next, cmd
+}
+
+// clampSelections keeps both selections inside their lists, so that a
+// list changing size never leaves an index past its end. Update applies it
+// after every message.
+func (m model) clampSelections() model {
+	m.selectedPeer = min(max(m.selectedPeer, 0), max(len(m.peers)-1, 0))
+	m.selectedFile = min(max(m.selectedFile, 0), max(len(m.files)-1, 0))
+	if len(m.peers) == 0 {
+		m.renaming = false // there is no peer left to rename
+	}
+	waiting := len(m.waiting())
+	m.queueSel = min(max(m.queueSel, 0), max(waiting-1, 0))
+	if waiting == 0 {
+		m.queueFocus = false // nothing left to reorder
+	}
+	return m
+}
+
+func (m model) update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+
 	case tea.KeyMsg:
-		switch msg.Type {
-		case tea.KeyEsc, tea.KeyCtrlC:
-			return m, tea.Quit
-
-		case tea.KeyDown:
-			if m.stage == "peers" && len(m.peers) > 0 && m.selectedPeer < len(m.peers)-1 {
-				m.selectedPeer++
-			} else if m.stage == "files" && len(m.files) > 0 && m.selectedFile < len(m.files)-1 {
-				m.selectedFile++
+		if m.confirmQuit {
+			return m.handleQuitPrompt(msg)
+		}
+		if len(m.naming) > 0 {
+			return m.handleNameInput(msg), nil
+		}
+		if m.renaming {
+			return m.handleAliasInput(msg), nil
+		}
+		if m.adding {
+			return m.handlePeerInput(msg), nil
+		}
+		if len(m.conflicts) > 0 {
+			if answer, ok := map[string]string{"o": conflictOverwrite, "r": conflictRename, "s": conflictSkip}[msg.String()]; ok {
+				m.conflicts[0].answer <- answer
+				m.conflicts = m.conflicts[1:]
+				return m, nil
 			}
-
-		case tea.KeyUp:
-			if m.stage == "peers" && m.selectedPeer > 0 {
-				m.selectedPeer--
-			} else if m.stage == "files" && m.selectedFile > 0 {
-				m.selectedFile--
+		}
+		if m.queueFocus {
+			if next, ok := m.handleQueueKey(msg); ok {
+				return next, nil
 			}
-
-		case tea.KeyEnter:
+		}
+		switch msg.String() {
+		case "q", "esc", "ctrl+c":
+			if m.transfer != nil {
+				m.confirmQuit = true
+				return m, nil
+			}
+			return m.quit()
+		case "down", "j":
+			m = m.moveSelection(1)
+		case "up", "k":
+			m = m.moveSelection(-1)
+		case "g", "home":
+			m = m.selectIndex(0)
+		case "G", "end":
+			items, _ := m.cursor()
+			m = m.selectIndex(len(items) - 1)
+		case "c":
+			if m.transfer != nil && !m.transfer.cancelled {
+				m.transfer.cancelled = true
+				m.transfer.cancel()
+				m.status = "🚫 Cancelling transfer..."
+			}
+		case "tab":
+			if len(m.waiting()) > 0 {
+				m.queueFocus = true
+			}
+		case "h":
+			m.showHistory = !m.showHistory
+		case "v":
+			m.compact = !m.compact
+		case "a":
+			if m.stage == "peers" && m.probing == "" {
+				m.adding = true
+				m.peerInput, m.peerInputErr = "", ""
+			}
+		case "r":
 			if m.stage == "peers" && len(m.peers) > 0 {
-				m.status = "📂 Select a file to send"
-				m.stage = "files"
-				m.selectedFile = 0
-			} else if m.stage == "files" && len(m.files) > 0 {
-				m.status = "📡 Sending file: " + m.files[m.selectedFile] + " to " + m.peers[m.selectedPeer]
-				go sendFile(m.files[m.selectedFile], m.peers[m.selectedPeer])
+				m.renaming = true
+				m.aliasInput = m.aliases[m.selectedPeerID()]
+			}
+		case "enter":
+			m, cmd := m.confirm()
+			m.clickedRow = -1
+			return m, cmd
+		}
+		m.clickedRow = -1
+
+	case tea.MouseMsg:
+		return m.handleMouse(msg)
+
+	case nameMsg:
+		if len(m.naming) == 0 {
+			m.nameInput, m.nameInputErr = msg.name, ""
+		}
+		m.naming = append(m.naming, msg)
+
+	case conflictMsg:
+		m.conflicts = append(m.conflicts, msg)
+
+	case progressMsg:
+		if m.transfer != nil {
+			m.transfer.observe(time.Now(), msg.done, msg.total)
+			return m, waitForTransfer(m.transfer.events)
+		}
+
+	case probeMsg:
+		m.probing = ""
+		if msg.err != nil {
+			m.status = errorStyle.Render("❌ " + msg.peer + " is offline: " + msg.err.Error())
+			return m, nil
+		}
+		if m.stage == "peers" {
+			m.status = "📂 Select a file to send"
+			m.stage = "files"
+			m.selectedFile = m.lastFileIndex()
+		}
+
+	case serverUpMsg:
+		m.listening = msg.addrs
+
+	case serverErrMsg:
+		m.status = errorStyle.Render("❌ " + msg.err.Error())
+		m.serverErr = msg.err
+
+	case transferResultMsg:
+		cancelled := false
+		if msg.sent && m.transfer != nil {
+			cancelled = m.transfer.cancelled
+			m.transfer = nil
+			m.confirmQuit = false
+		}
+		record := msg
+		if cancelled {
+			record.err = errors.New("cancelled")
+		}
+		m.history = append(m.history, record)
+		if len(m.history) > maxHistory {
+			m.history = m.history[len(m.history)-maxHistory:]
+		}
+		switch {
+		case cancelled:
+			m.status = errorStyle.Render("🚫 Transfer cancelled")
+		case msg.err != nil:
+			m.status = errorStyle.Render("❌ " + msg.err.Error())
+		case msg.sent:
+			status := fmt.Sprintf("✅ Sent %s (%s) %s", filepath.Base(msg.name), units.Bytes(float64(msg.size)), msg.pace())
+			if simulate {
+				status += simulatedNote
 			}
+			m.status = statusStyle.Render(status)
+		default:
+			m.status = statusStyle.Render(fmt.Sprintf("✅ Received %s (%s) from %s %s", msg.name, units.Bytes(float64(msg.size)), msg.peer, msg.pace()))
 		}
+		var notice tea.Cmd
+		if !cancelled {
+			notice = m.notifyResult(msg)
+		}
+		if msg.sent {
+			m.finishJob(record.err)
+			next, cmd := m.startNext()
+			return next, tea.Batch(cmd, notice)
+		}
+		return m, notice
+
+	case peerFoundMsg:
+		if m.discovery == nil {
+			return m, nil
+		}
+		m.hostnames[msg.addr] = msg.hostname
+		if !slices.Contains(m.peers, msg.addr) {
+			m.peers = append(m.peers, msg.addr)
+		}
+		m.discovery.found++
+		if len(m.peers) == 1 {
+			m.status = statusStyle.Render("✅ Peers found! Select one.")
+		}
+		m = m.restoreLastPeer()
+		return m, waitForTransfer(m.discovery.events)
+
+	case searchOnlyMsg:
+		m.searchOnly = true
+		m.status = errorStyle.Render(fmt.Sprintf("⚠️  Discovery port %d is taken: searching from a spare port instead; peers cannot discover this instance", discoveryPort))
+		if m.discovery == nil {
+			return m, nil
+		}
+		return m, waitForTransfer(m.discovery.events)
 
-	case []string:
-		if len(msg) == 0 {
+	case discoveryTickMsg:
+		if m.discovery != nil {
+			return m, discoveryTick()
+		}
+
+	case peersMsg:
+		// A search cancelled for a manually added peer has nothing to add
+		// to the status.
+		cancelled := m.discovery != nil && m.discovery.ctx.Err() != nil
+		m.discovery = nil
+		for addr, hostname := range msg.hostnames {
+			m.hostnames[addr] = hostname
+		}
+		// Peers normally arrived one by one already; keep their order and
+		// the selection.
+		for _, peer := range msg.peers {
+			if !slices.Contains(m.peers, peer) {
+				m.peers = append(m.peers, peer)
+			}
+		}
+		m = m.restoreLastPeer()
+		if !cancelled && len(m.peers) == 0 {
 			m.status = errorStyle.Render("❌ No peers found.")
+		}
+
+	case discoveryErrMsg:
+		cancelled := m.discovery != nil && m.discovery.ctx.Err() != nil
+		m.discovery = nil
+		if cancelled {
+			return m, nil
+		}
+		m.status = errorStyle.Render(fmt.Sprintf("❌ Discovery failed: %v, retrying in %s", msg.err, discoveryRetry))
+		return m, tea.Tick(discoveryRetry, func(time.Time) tea.Msg { return discoveryRetryMsg{} })
+
+	case discoveryRetryMsg:
+		// A peer added by hand in the meantime makes the retry moot.
+		if m.discovery == nil && len(m.peers) == 0 && m.stage == "peers" {
+			m.discovery = newDiscovery()
+			m.status = "🔍 Searching for peers..."
+			return m, m.discovery.start()
+		}
+	}
+
+	return m, nil
+}
+
+// quit stops any running discovery and exits.
+func (m model) quit() (tea.Model, tea.Cmd) {
+	if m.discovery != nil {
+		m.discovery.cancel()
+	}
+	return m, tea.Quit
+}
+
+// handleQuitPrompt handles a key while asking whether to abandon a
+// transfer: q forces the quit, c cancels just the transfer, and anything
+// else dismisses the prompt.
+func (m model) handleQuitPrompt(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.confirmQuit = false
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return m.quit()
+	case "c":
+		if m.transfer != nil {
+			m.transfer.cancelled = true
+			m.transfer.cancel()
+			m.status = "🚫 Cancelling transfer..."
+		}
+	}
+	return m, nil
+}
+
+// handleAliasInput edits the selected peer's alias. Enter saves it, an
+// empty alias removes it, and Esc leaves it unchanged.
+func (m model) handleAliasInput(msg tea.KeyMsg) model {
+	switch msg.Type {
+	case tea.KeyEsc, tea.KeyCtrlC:
+		m.renaming = false
+	case tea.KeyEnter:
+		m.renaming = false
+		id := m.selectedPeerID()
+		aliases := make(map[string]string, len(m.aliases)+1)
+		for k, v := range m.aliases {
+			aliases[k] = v
+		}
+		if alias := strings.TrimSpace(m.aliasInput); alias != "" {
+			aliases[id] = alias
 		} else {
-			m.peers = msg
-			m.status = statusStyle.Render("✅ Peers found! Select one.")
-			m.selectedPeer = 0
+			delete(aliases, id)
+		}
+		if err := saveAliases(aliases); err != nil {
+			m.status = errorStyle.Render("❌ Saving alias: " + err.Error())
+			return m
 		}
+		m.aliases = aliases
+		m.status = statusStyle.Render("✅ Saved alias for " + m.peerLabel(m.peers[m.selectedPeer]))
+	case tea.KeyBackspace:
+		if r := []rune(m.aliasInput); len(r) > 0 {
+			m.aliasInput = string(r[:len(r)-1])
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		m.aliasInput += string(msg.Runes)
+	}
+	return m
+}
+
+// handlePeerInput edits the manually entered peer address. Enter adds it
+// to the list and selects it, stopping discovery if it is still running.
+func (m model) handlePeerInput(msg tea.KeyMsg) model {
+	switch msg.Type {
+	case tea.KeyEsc, tea.KeyCtrlC:
+		m.adding = false
+	case tea.KeyEnter:
+		peer, err := parsePeerAddr(m.peerInput)
+		if err != nil {
+			m.peerInputErr = err.Error()
+			return m
+		}
+		m.adding = false
+		if m.discovery != nil {
+			m.discovery.cancel()
+		}
+		i := slices.Index(m.peers, peer)
+		if i < 0 {
+			m.peers = append(m.peers, peer)
+			i = len(m.peers) - 1
+		}
+		m.selectedPeer = i
+		m.restorePeer = false
+		m.status = statusStyle.Render("✅ Added " + peer + ". Press Enter to select it.")
+	case tea.KeyBackspace:
+		if r := []rune(m.peerInput); len(r) > 0 {
+			m.peerInput = string(r[:len(r)-1])
+		}
+		m.peerInputErr = ""
+	case tea.KeyRunes:
+		m.peerInput += string(msg.Runes)
+		m.peerInputErr = ""
 	}
+	return m
+}
+
+// handleNameInput edits the save name of the first incoming file waiting
+// for one. Enter saves under the typed name, and Esc, or an empty name,
+// keeps the sender's.
+func (m model) handleNameInput(msg tea.KeyMsg) model {
+	next := func(answer string) model {
+		m.naming[0].answer <- answer
+		m.naming = m.naming[1:]
+		if len(m.naming) > 0 {
+			m.nameInput = m.naming[0].name
+		}
+		m.nameInputErr = ""
+		return m
+	}
+	switch msg.Type {
+	case tea.KeyEsc, tea.KeyCtrlC:
+		return next(m.naming[0].name)
+	case tea.KeyEnter:
+		name := strings.TrimSpace(m.nameInput)
+		if name == "" {
+			return next(m.naming[0].name)
+		}
+		if err := plainName(name); err != nil {
+			m.nameInputErr = err.Error()
+			return m
+		}
+		return next(name)
+	case tea.KeyBackspace:
+		if r := []rune(m.nameInput); len(r) > 0 {
+			m.nameInput = string(r[:len(r)-1])
+		}
+		m.nameInputErr = ""
+	case tea.KeyRunes, tea.KeySpace:
+		m.nameInput += string(msg.Runes)
+		m.nameInputErr = ""
+	}
+	return m
+}
 
+// selectedPeerID is the alias key of the selected peer.
+func (m model) selectedPeerID() string {
+	peer := m.peers[m.selectedPeer]
+	return peerID(peer, m.hostnames[peer])
+}
+
+// peerLabel names a peer by its alias, then its hostname, then its address.
+func (m model) peerLabel(peer string) string {
+	hostname := m.hostnames[peer]
+	if alias, ok := m.aliases[peerID(peer, hostname)]; ok {
+		return alias + " (" + peer + ")"
+	}
+	if hostname != "" {
+		return hostname + " (" + peer + ")"
+	}
+	return peer
+}
+
+// confirm acts on the current selection, as Enter does.
+func (m model) confirm() (model, tea.Cmd) {
+	var cmd tea.Cmd
+	if m.stage == "peers" && len(m.peers) > 0 {
+		if m.selectedPeer < 0 || m.selectedPeer >= len(m.peers) {
+			return m, nil
+		}
+		if m.probing != "" {
+			return m, nil
+		}
+		if err := checkNotSelf(m.peers[m.selectedPeer]); err != nil {
+			m.status = errorStyle.Render("🚫 Not sending to " + m.peerLabel(m.peers[m.selectedPeer]) + ": " + err.Error())
+			return m, nil
+		}
+		m.probing = m.peers[m.selectedPeer]
+		m.status = "🔎 Checking " + m.probing + "..."
+		cmd = probePeer(m.probing)
+	} else if m.stage == "files" {
+		if m.selectedFile < 0 || m.selectedFile >= len(m.files) || m.selectedPeer >= len(m.peers) {
+			m.status = errorStyle.Render("📭 There is no file to send here")
+			return m, nil
+		}
+		if name := m.files[m.selectedFile]; m.noAccess[name] {
+			m.status = errorStyle.Render("🔒 Cannot send " + name + ": no permission to read it")
+			return m, nil
+		}
+		m, cmd = m.enqueue(m.files[m.selectedFile], m.peers[m.selectedPeer])
+		if *rememberFlag {
+			// Best effort: failing to remember is not worth interrupting for.
+			saveLastUsed(m.peers[m.selectedPeer], m.selectedPeerID(), m.files[m.selectedFile])
+		}
+	}
+	return m, cmd
+}
+
+// cursor returns the list shown in the current stage and its selection.
+func (m *model) cursor() ([]string, *int) {
+	if m.stage == "files" {
+		return m.files, &m.selectedFile
+	}
+	return m.peers, &m.selectedPeer
+}
+
+// moveSelection moves the selection by delta rows.
+func (m model) moveSelection(delta int) model {
+	_, selected := m.cursor()
+	return m.selectIndex(*selected + delta)
+}
+
+// selectIndex selects row i, clamped to the list.
+func (m model) selectIndex(i int) model {
+	items, selected := m.cursor()
+	*selected = i
+	if m.stage == "peers" {
+		m.restorePeer = false
+	}
+	if *selected > len(items)-1 {
+		*selected = len(items) - 1
+	}
+	if *selected < 0 {
+		*selected = 0
+	}
+	return m
+}
+
+// handleMouse selects the clicked row; clicking the selected row a second
+// time confirms it. The wheel moves the selection.
+func (m model) handleMouse(msg tea.MouseMsg) (model, tea.Cmd) {
+	switch msg.Button {
+	case tea.MouseButtonWheelUp:
+		m.clickedRow = -1
+		return m.moveSelection(-1), nil
+	case tea.MouseButtonWheelDown:
+		m.clickedRow = -1
+		return m.moveSelection(1), nil
+	}
+	if msg.Button != tea.MouseButtonLeft || msg.Action != tea.MouseActionPress {
+		return m, nil
+	}
+
+	_, selected := m.cursor()
+	start, end, scrolled := m.listWindow()
+	row := msg.Y - strings.Count(m.header(), "\n")
+	if scrolled {
+		row-- // the "↑ more" line
+	}
+	if row < 0 || start+row >= end {
+		return m, nil
+	}
+	row += start
+	if row == *selected && row == m.clickedRow {
+		m.clickedRow = -1
+		return m.confirm()
+	}
+	*selected = row
+	m.clickedRow = row
 	return m, nil
 }
 
-func (m model) View() string {
+// header renders everything above the list rows. The mouse handler uses
+// its height to map click positions onto rows.
+func (m model) header() string {
 	var b strings.Builder
 
 	b.WriteString(titleStyle.Render("🔗 P2P File Sharing") + "\n\n")
-	b.WriteString(boxStyle.Render(m.status) + "\n\n")
+	status := m.status
+	if m.discovery != nil {
+		status += footerStyle.UnsetPaddingTop().Render("  " + m.discovery.progress())
+	}
+	if len(m.conflicts) > 0 {
+		c := m.conflicts[0]
+		status = errorStyle.Render("📥 " + c.peer + " is sending " + c.name + ", which already exists: [o]verwrite, [r]ename or [s]kip?")
+	}
+	if m.confirmQuit {
+		status = errorStyle.Render("⚠️  Transfer in progress — press q again to force quit, or c to cancel just the transfer")
+	}
+	if m.renaming {
+		status = "✏️  Alias for " + m.peers[m.selectedPeer] + ": " + m.aliasInput + "█  (Enter to save, empty to clear, Esc to cancel)"
+	}
+	if m.adding {
+		status = "➕ Peer address: " + m.peerInput + "█  (Enter to add, Esc to cancel)"
+		if m.peerInputErr != "" {
+			status += "\n" + errorStyle.Render("❌ "+m.peerInputErr)
+		}
+	}
+	if len(m.naming) > 0 {
+		n := m.naming[0]
+		status = fmt.Sprintf("📥 %s is sending %s (%s). Save as: %s█  (Enter to save, Esc to keep the name)",
+			n.peer, n.name, units.Bytes(float64(n.size)), m.nameInput)
+		if m.nameInputErr != "" {
+			status += "\n" + errorStyle.Render("❌ "+m.nameInputErr)
+		}
+	}
+	b.WriteString(boxStyle.Render(status) + "\n\n")
+	if m.transfer != nil {
+		if m.compact {
+			b.WriteString(m.transfer.line(m.peerLabel(m.transfer.peer)) + "\n\n")
+		} else {
+			b.WriteString(m.transfer.view() + "\n\n")
+		}
+	}
+	if queue := m.queueView(); queue != "" {
+		b.WriteString(queue + "\n\n")
+	}
 
 	if m.stage == "peers" {
 		b.WriteString("🌍 Select a Peer:\n")
-		for i, peer := range m.peers {
-			if i == m.selectedPeer {
-				b.WriteString(selectedStyle.Render("👉 "+peer) + "\n")
-			} else {
-				b.WriteString(peerStyle.Render("• "+peer) + "\n")
-			}
-		}
 	} else if m.stage == "files" {
 		b.WriteString("📂 Select a File:\n")
-		for i, file := range m.files {
-			if i == m.selectedFile {
-				b.WriteString(selectedStyle.Render("👉 "+file) + "\n")
-			} else {
-				b.WriteString(peerStyle.Render("• "+file) + "\n")
-			}
+		if m.filesDir != "" {
+			b.WriteString(footerStyle.UnsetPaddingTop().Render("  from "+m.filesDir+", where you last sent from (-from . lists the working directory)") + "\n")
+		}
+	}
+	return b.String()
+}
+
+// historyView renders the most recent transfers in a box.
+func (m model) historyView() string {
+	if len(m.history) == 0 {
+		return boxStyle.Render("📜 No transfers yet this session")
+	}
+	start := len(m.history) - historyRows
+	if start < 0 {
+		start = 0
+	}
+	lines := []string{"📜 Transfer history"}
+	for _, r := range m.history[start:] {
+		direction, arrow := "received", "←"
+		if r.sent {
+			direction, arrow = "sent", "→"
+		}
+		result := statusStyle.Render("ok")
+		if r.err != nil {
+			result = errorStyle.Render(r.err.Error())
 		}
+		lines = append(lines, fmt.Sprintf("%-8s %s %s %s  %s  %s  %s",
+			direction, filepath.Base(r.name), arrow, r.peer,
+			units.Bytes(float64(r.size)), r.elapsed.Round(100*time.Millisecond), result))
 	}
+	return boxStyle.Render(strings.Join(lines, "\n"))
+}
 
-	b.WriteString(footerStyle.Render("\n↑↓ to navigate, Enter to select, 'q' to quit."))
+// view renders a progress bar with the amount sent, rate and ETA.
+func (t *outgoing) view() string {
+	const width = 30
+	filled := 0
+	percent := 0.0
+	if t.total > 0 {
+		percent = float64(t.done) / float64(t.total) * 100
+		filled = int(float64(t.done) / float64(t.total) * width)
+	}
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", width-filled)
+	return fmt.Sprintf("%s %3.0f%%  %s / %s  %s  %s",
+		statusStyle.Render(bar), percent,
+		units.Bytes(float64(t.done)), units.Bytes(float64(t.total)),
+		units.Rate(t.rate()), t.eta())
+}
 
-	return b.String()
+// line renders the transfer as one row of the compact readout: peer, file,
+// percentage, rate and ETA.
+func (t *outgoing) line(peer string) string {
+	percent := 0.0
+	if t.total > 0 {
+		percent = float64(t.done) / float64(t.total) * 100
+	}
+	return fmt.Sprintf("%-24s  %-24s %s  %10s  %s",
+		truncate(peer, 24), truncate(t.name, 24), statusStyle.Render(fmt.Sprintf("%3.0f%%", percent)),
+		units.Rate(t.rate()), t.eta())
 }
 
-func discoverPeers() tea.Msg {
-	conn, err := net.ListenPacket("udp4", ":9876")
-	if err != nil {
-		return []string{"Error: " + err.Error()}
+// truncate shortens s to at most n runes, marking the cut with an ellipsis.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
 	}
-	defer conn.Close()
+	return string(r[:n-1]) + "…"
+}
 
-	buf := make([]byte, 1024)
-	peers := make(map[string]struct{})
+// footer renders everything below the list rows.
+func (m model) footer() string {
+	var b strings.Builder
+	if m.showHistory {
+		b.WriteString("\n" + m.historyView() + "\n")
+	}
+	cancel := ""
+	if m.transfer != nil {
+		cancel = "'c' cancel send, "
+	}
+	if len(m.waiting()) > 0 {
+		cancel += "Tab queue, "
+	}
+	b.WriteString(footerStyle.Render("\n↑↓/jk to navigate, g/G top/bottom, Enter to select, 'a' add peer, 'r' rename peer, 'h' history, 'v' compact progress, " + cancel + "'q' to quit."))
+	b.WriteString("\n" + m.receiverView())
+	return b.String()
+}
 
-	broadcastAddr := &net.UDPAddr{IP: net.IPv4bcast, Port: 9876}
-	_, err = conn.WriteTo([]byte("DISCOVER_PEER"), broadcastAddr)
-	if err != nil {
-		return []string{"Error sending broadcast: " + err.Error()}
+// receiverView is the status bar showing whether files can be received,
+// and where they go.
+func (m model) receiverView() string {
+	switch {
+	case m.serverErr != nil:
+		return errorStyle.Render("📥 Not receiving: " + m.serverErr.Error())
+	case m.listening == nil:
+		return footerStyle.UnsetPaddingTop().Render("📥 Starting receiver...")
+	}
+	line := "📥 Listening on " + strings.Join(m.listening, ", ") + ", saving to " + downloadDir
+	if hostname, err := os.Hostname(); err == nil {
+		line += ", name=" + hostname
+	}
+	line = footerStyle.UnsetPaddingTop().Render(line)
+	if m.searchOnly {
+		line += "\n" + errorStyle.Render(fmt.Sprintf("⚠️  Discovery port %d is in use, probably by another p2pshare, so this instance searches from a spare port: it can find peers, but they cannot discover it and must add it by address. Use -discovery-port to pick another.", discoveryPort))
 	}
+	return line
+}
 
-	go func() {
-		for {
-			n, addr, err := conn.ReadFrom(buf)
-			if err == nil {
-				message := string(buf[:n])
-				if message == "DISCOVER_PEER" {
-					conn.WriteTo([]byte("PEER_RESPONSE"), addr)
-				} else if message == "PEER_RESPONSE" {
-					peers[addr.String()] = struct{}{}
-				}
-			}
-		}
-	}()
+// listWindow returns the range of list rows that fit between the header
+// and footer, paging so that the selection stays visible. scrolled is set
+// when the list does not fit, in which case a "more" line is drawn above
+// and below the rows.
+func (m model) listWindow() (start, end int, scrolled bool) {
+	items, selected := m.cursor()
+	rows := m.height - lineCount(m.header()) - lineCount(m.footer())
+	if m.height == 0 || len(items) <= rows {
+		return 0, len(items), false
+	}
+	page := rows - 2 // room for the "more" lines
+	if page < 1 {
+		page = 1
+	}
+	start = *selected / page * page
+	end = min(start+page, len(items))
+	return start, end, true
+}
+
+// lineCount is the number of lines s occupies.
+func lineCount(s string) int {
+	return strings.Count(s, "\n") + 1
+}
 
-	time.Sleep(2 * time.Second)
+func (m model) View() string {
+	var b strings.Builder
 
-	peerList := []string{}
-	for peer := range peers {
-		peerList = append(peerList, peer)
+	b.WriteString(m.header())
+
+	items, selected := m.cursor()
+	start, end, scrolled := m.listWindow()
+	if scrolled {
+		if start > 0 {
+			b.WriteString(footerStyle.Render(fmt.Sprintf("  ↑ %d more", start)))
+		}
+		b.WriteString("\n")
+	}
+	if m.stage == "files" && len(items) == 0 {
+		if m.filesErr != nil {
+			b.WriteString(errorStyle.Render("  ❌ Cannot read this directory: "+m.filesErr.Error()) + "\n")
+		} else {
+			b.WriteString(footerStyle.UnsetPaddingTop().Render("  📭 No files here, only subdirectories or nothing at all. Run p2pshare from the folder you want to send from.") + "\n")
+		}
+	}
+	for i := start; i < end; i++ {
+		label := items[i]
+		if m.stage == "peers" {
+			label = m.peerLabel(label)
+		}
+		if m.stage == "files" && m.noAccess[label] {
+			label += footerStyle.UnsetPaddingTop().Render(" (no access)")
+		}
+		if i == *selected {
+			b.WriteString(selectedStyle.Render("👉 "+label) + "\n")
+		} else {
+			b.WriteString(peerStyle.Render("• "+label) + "\n")
+		}
+	}
+	if scrolled && end < len(items) {
+		b.WriteString(footerStyle.Render(fmt.Sprintf("  ↓ %d more", len(items)-end)) + "\n")
 	}
 
-	return peerList
+	b.WriteString(m.footer())
+
+	return b.String()
 }
 
-func getFiles() []string {
-	files := []string{}
+// getFiles lists the files in the working directory, which are the files
+// that can be sent. Those that cannot be opened are also in noAccess, so
+// they can be shown but not sent. err is only set when nothing could be
+// listed; entries read before a failure part way through are kept.
+func getFiles() (files []string, noAccess map[string]bool, err error) {
+	files, noAccess = []string{}, map[string]bool{}
 	entries, err := os.ReadDir(".")
-	if err != nil {
-		return []string{"Error: Unable to read directory"}
+	if err != nil && len(entries) == 0 {
+		return files, noAccess, err
 	}
 	for _, entry := range entries {
-		if !entry.IsDir() {
-			files = append(files, entry.Name())
+		if entry.IsDir() {
+			continue
+		}
+		files = append(files, entry.Name())
+		if !readable(entry.Name()) {
+			noAccess[entry.Name()] = true
 		}
 	}
-	return files
+	return files, noAccess, nil
 }
 
-func startServer() {
-	listener, err := net.Listen("tcp", ":9000")
+// readable reports whether the file at path can be opened for reading.
+// Only regular files, directly or through a symlink, are opened, since
+// opening a FIFO would block.
+func readable(path string) bool {
+	info, err := os.Stat(path)
 	if err != nil {
-		fmt.Println("Error starting TCP server:", err)
-		return
+		return false
 	}
-	defer listener.Close()
-
-	fmt.Println("📡 Listening for incoming files...")
-
-	for {
-		conn, err := listener.Accept()
-		if err != nil {
-			fmt.Println("Connection error:", err)
-			continue
-		}
-		go receiveFile(conn)
+	if !info.Mode().IsRegular() {
+		return true
 	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
 }
 
-func sendFile(filename, peer string) {
-	host, _, err := net.SplitHostPort(peer)
-	if err != nil {
-		fmt.Println(errorStyle.Render("❌ Invalid peer address:", peer))
+func main() {
+	flag.Parse()
+
+	if *versionFlag {
+		fmt.Println(version.String("p2pshare"))
 		return
 	}
 
-	conn, err := net.Dial("tcp", host+":9000")
+	palette, warnings := theme.Load(*themeFlag)
+	for _, w := range warnings {
+		fmt.Fprintln(os.Stderr, w)
+	}
+	palette, err := theme.Override(palette, *paletteFlag)
 	if err != nil {
-		fmt.Println(errorStyle.Render("❌ Error connecting to peer:", err.Error()))
-		return
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(2)
+	}
+	if ui.BasicColors() {
+		palette = palette.Basic()
+	}
+	applyTheme(palette)
+	if theme.NoColor() {
+		ui.Plain()
 	}
-	defer conn.Close()
 
-	file, err := os.Open(filename)
+	limit, err := parseRate(*limitFlag)
 	if err != nil {
-		fmt.Println(errorStyle.Render("❌ Error opening file:", err.Error()))
-		return
+		fmt.Fprintln(os.Stderr, "Error: -limit:", err)
+		os.Exit(2)
 	}
-	defer file.Close()
+	sendLimit = limit
+	chunkedSend = *chunkedFlag
+	simulate = *simulateFlag
+	notifyDesktop = *notifyFlag
 
-	_, err = io.Copy(conn, file)
-	if err != nil {
-		fmt.Println(errorStyle.Render("❌ Error sending file:", err.Error()))
-		return
+	for _, p := range []struct {
+		name string
+		port int
+	}{{"port", *portFlag}, {"discovery-port", *discPortFlag}} {
+		if p.port < 1 || p.port > 65535 {
+			fmt.Fprintf(os.Stderr, "Error: -%s must be between 1 and 65535\n", p.name)
+			os.Exit(2)
+		}
 	}
+	transferPort = strconv.Itoa(*portFlag)
+	discoveryPort = *discPortFlag
 
-	fmt.Println(statusStyle.Render("✅ File sent successfully!"))
-}
+	if *dialFlag <= 0 {
+		fmt.Fprintln(os.Stderr, "Error: -dial-timeout must be positive")
+		os.Exit(2)
+	}
+	dialTimeout = *dialFlag
 
-func receiveFile(conn net.Conn) {
-	defer conn.Close()
-	file, err := os.Create("received_file")
-	if err != nil {
-		fmt.Println("❌ Error creating file:", err)
-		return
+	if *idleFlag < 0 {
+		fmt.Fprintln(os.Stderr, "Error: -idle-timeout must not be negative")
+		os.Exit(2)
 	}
-	defer file.Close()
+	idleTimeout = *idleFlag
 
-	_, err = io.Copy(file, conn)
-	if err != nil {
-		fmt.Println("❌ Error receiving file:", err)
+	if *windowFlag <= 0 {
+		fmt.Fprintln(os.Stderr, "Error: -discovery-window must be positive")
+		os.Exit(2)
+	}
+	discoveryWindow = *windowFlag
+
+	switch *discoveryFlag {
+	case "broadcast", "multicast":
+		discoveryMode = *discoveryFlag
+	default:
+		fmt.Fprintf(os.Stderr, "Error: -discovery must be broadcast or multicast, not %q\n", *discoveryFlag)
+		os.Exit(2)
+	}
+
+	switch *ipFlag {
+	case "v4", "v6", "both":
+		ipVersion = *ipFlag
+	default:
+		fmt.Fprintf(os.Stderr, "Error: -ip must be v4, v6 or both, not %q\n", *ipFlag)
+		os.Exit(2)
+	}
+
+	if *bindFlag != "" {
+		b, err := resolveBind(*bindFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: -bind:", err)
+			os.Exit(2)
+		}
+		if ipVersion == "v4" && b.addr == nil {
+			fmt.Fprintf(os.Stderr, "Error: -bind: %s has no IPv4 address; use -ip v6 or both\n", b.iface.Name)
+			os.Exit(2)
+		}
+		bound = b
+	}
+
+	switch *conflictFlag {
+	case conflictPrompt, conflictOverwrite, conflictRename, conflictSkip:
+		conflictPolicy = *conflictFlag
+	default:
+		fmt.Fprintf(os.Stderr, "Error: -on-conflict must be prompt, overwrite, rename or skip, not %q\n", *conflictFlag)
+		os.Exit(2)
+	}
+	askName = *askNameFlag
+	if err := os.MkdirAll(*dirFlag, 0o755); err != nil {
+		fmt.Fprintln(os.Stderr, "Error: -dir:", err)
+		os.Exit(1)
+	}
+	downloadDir = *dirFlag
+	if abs, err := filepath.Abs(downloadDir); err == nil {
+		// Kept absolute so that -from and the remembered directory, which
+		// change the working directory, do not move received files.
+		downloadDir = abs
+	}
+
+	args := flag.Args()
+	if len(args) == 0 && !*listenFlag && !term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Fprintln(os.Stderr, "p2pshare: stdout is not a terminal; receiving files as with -listen (use the send command to send)")
+		*listenFlag = true
+	}
+	if *listenFlag {
+		args = append([]string{"receive"}, args...)
+	}
+	if len(args) > 0 {
+		if err := runCommand(args); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			var usage usageError
+			if errors.As(err, &usage) {
+				os.Exit(2)
+			}
+			os.Exit(1)
+		}
 		return
 	}
 
-	fmt.Println("✅ File received successfully!")
-}
+	if *stdoutFlag {
+		fmt.Fprintln(os.Stderr, "Error: -stdout only works when receiving without the UI, with receive or -listen")
+		os.Exit(2)
+	}
 
-func main() {
-	p := tea.NewProgram(initialModel())
+	var last lastUsed
+	if *rememberFlag {
+		last = loadLastUsed()
+	}
+	dirSet := false
+	flag.Visit(func(f *flag.Flag) { dirSet = dirSet || f.Name == "dir" })
+	restored, err := chooseSendDir(*fromFlag, last.Dir, dirSet)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: -from:", err)
+		os.Exit(1)
+	}
+	m := initialModel()
+	m.filesDir = restored
+	if *rememberFlag {
+		m.last = last
+		m.restorePeer = m.last.Peer != ""
+	}
+	if m.aliases, err = loadAliases(); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: peer aliases:", err)
+	}
+
+	opts := []tea.ProgramOption{tea.WithMouseCellMotion()}
+	if !*inlineFlag {
+		opts = append(opts, tea.WithAltScreen())
+	}
+	p := tea.NewProgram(m, opts...)
+	go startServer(p.Send)
 	if _, err := p.Run(); err != nil {
 		fmt.Println("Error:", err)
 		os.Exit(1)
 	}
-	go startServer()
 }
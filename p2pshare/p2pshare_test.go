@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestClampSelectionsAfterShrink(t *testing.T) {
+	tests := []struct {
+		name         string
+		peers, files int
+		wantPeer     int
+		wantFile     int
+	}{
+		{"shorter", 2, 3, 1, 2},
+		{"one left", 1, 1, 0, 0},
+		{"empty", 0, 0, 0, 0},
+	}
+	// Keep anything the model remembers out of the real state directory.
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	for _, tt := range tests {
+		for _, stage := range []string{"peers", "files"} {
+			t.Run(tt.name+"/"+stage, func(t *testing.T) {
+				m := model{
+					stage:        stage,
+					peers:        []string{"10.0.0.1:9000", "10.0.0.2:9000", "10.0.0.3:9000", "10.0.0.4:9000", "10.0.0.5:9000"},
+					files:        []string{"a", "b", "c", "d", "e", "f"},
+					hostnames:    map[string]string{},
+					selectedPeer: 4,
+					selectedFile: 5,
+					clickedRow:   -1,
+				}
+				m.peers = m.peers[:tt.peers]
+				m.files = m.files[:tt.files]
+
+				next, _ := m.Update(tea.WindowSizeMsg{Width: 80, Height: 24})
+				got := next.(model)
+				if got.selectedPeer != tt.wantPeer || got.selectedFile != tt.wantFile {
+					t.Errorf("selections = peer %d, file %d; want peer %d, file %d",
+						got.selectedPeer, got.selectedFile, tt.wantPeer, tt.wantFile)
+				}
+				got.View()
+				keys := []tea.KeyType{tea.KeyUp, tea.KeyDown}
+				if stage == "peers" {
+					// Enter in the files stage would send to the peer
+					// and remember it.
+					keys = append(keys, tea.KeyEnter)
+				}
+				for _, key := range keys {
+					next, _ = got.Update(tea.KeyMsg{Type: key})
+					next.View()
+				}
+			})
+		}
+	}
+}
+
+func TestClampSelectionsNegative(t *testing.T) {
+	m := model{peers: []string{"10.0.0.1:9000"}, files: []string{"a"}, selectedPeer: -2, selectedFile: -1}
+	m = m.clampSelections()
+	if m.selectedPeer != 0 || m.selectedFile != 0 {
+		t.Errorf("selections = peer %d, file %d; want 0, 0", m.selectedPeer, m.selectedFile)
+	}
+}
+
+func TestGetFilesMixedPermissions(t *testing.T) {
+	dir := t.TempDir()
+	for name, mode := range map[string]os.FileMode{"open.txt": 0o644, "also-open.txt": 0o600} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A dangling symlink cannot be opened even by root, unlike a file
+	// with no permission bits.
+	if err := os.Symlink("missing.txt", filepath.Join(dir, "locked.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "subdir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	files, noAccess, err := getFiles()
+	if err != nil {
+		t.Fatalf("getFiles: %v", err)
+	}
+	slices.Sort(files)
+	if want := []string{"also-open.txt", "locked.txt", "open.txt"}; !slices.Equal(files, want) {
+		t.Errorf("files = %q, want %q", files, want)
+	}
+	if !noAccess["locked.txt"] || noAccess["open.txt"] || noAccess["also-open.txt"] || len(noAccess) != 1 {
+		t.Errorf("noAccess = %v, want only locked.txt", noAccess)
+	}
+
+	m := model{
+		stage:     "files",
+		peers:     []string{"10.0.0.1:9000"},
+		files:     files,
+		noAccess:  noAccess,
+		hostnames: map[string]string{},
+	}
+	m.selectedFile = slices.Index(files, "locked.txt")
+	m, cmd := m.confirm()
+	if cmd != nil || len(m.queue) != 0 || m.transfer != nil {
+		t.Errorf("confirming locked.txt queued a send: queue %v", m.queue)
+	}
+	if !strings.Contains(m.status, "no permission") {
+		t.Errorf("status = %q, want it to say there is no permission", m.status)
+	}
+}
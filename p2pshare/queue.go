@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"clifs/shared/units"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// jobState is how far a queued send has got.
+type jobState int
+
+const (
+	jobQueued jobState = iota
+	jobActive
+	jobDone
+	jobFailed
+)
+
+func (s jobState) String() string {
+	switch s {
+	case jobActive:
+		return "sending"
+	case jobDone:
+		return "done"
+	case jobFailed:
+		return "failed"
+	}
+	return "queued"
+}
+
+// job is one file to send to one peer. Jobs run in queue order, one at a
+// time, so the queue is always the finished jobs, then the active one, then
+// those still waiting.
+type job struct {
+	name  string
+	peer  string
+	state jobState
+	err   error // why a failed job failed
+}
+
+// maxFinishedJobs is the number of finished jobs kept in the queue for
+// context; older ones are only in the history.
+const maxFinishedJobs = 5
+
+// enqueue adds a send to the end of the queue and starts it if nothing else
+// is sending.
+func (m model) enqueue(name, peer string) (model, tea.Cmd) {
+	m.queue = append(m.queue, job{name: name, peer: peer})
+	if m.transfer != nil {
+		m.status = fmt.Sprintf("➕ Queued %s for %s (%d waiting)", name, m.peerLabel(peer), len(m.waiting()))
+		return m, nil
+	}
+	return m.startNext()
+}
+
+// startNext is the queue's worker: once the active send has finished it
+// starts the first job still waiting.
+func (m model) startNext() (model, tea.Cmd) {
+	if m.transfer != nil {
+		return m, nil
+	}
+	for i := range m.queue {
+		if m.queue[i].state != jobQueued {
+			continue
+		}
+		j := &m.queue[i]
+		j.state = jobActive
+		m.status = "📡 Sending file: " + j.name + " to " + j.peer
+		if sendLimit > 0 {
+			m.status += " (limit " + units.Rate(float64(sendLimit)) + ")"
+		}
+		if simulate {
+			m.status += simulatedNote
+		}
+		var cmd tea.Cmd
+		m.transfer, cmd = startSend(j.name, j.peer)
+		return m, cmd
+	}
+	return m, nil
+}
+
+// finishJob records the outcome of the active job and forgets the oldest
+// finished jobs beyond maxFinishedJobs.
+func (m *model) finishJob(err error) {
+	finished := 0
+	for i := range m.queue {
+		j := &m.queue[i]
+		if j.state == jobActive {
+			j.state, j.err = jobDone, err
+			if err != nil {
+				j.state = jobFailed
+			}
+		}
+		if j.state == jobDone || j.state == jobFailed {
+			finished++
+		}
+	}
+	if drop := finished - maxFinishedJobs; drop > 0 {
+		m.queue = m.queue[drop:]
+	}
+}
+
+// waiting returns the jobs that have not started, which are the only ones
+// that can be moved or removed.
+func (m model) waiting() []job {
+	for i, j := range m.queue {
+		if j.state == jobQueued {
+			return m.queue[i:]
+		}
+	}
+	return nil
+}
+
+// handleQueueKey handles a key while the queue has the focus. ok is false
+// for keys the queue does not use, which are handled as usual.
+func (m model) handleQueueKey(msg tea.KeyMsg) (model, bool) {
+	waiting := m.waiting()
+	first := len(m.queue) - len(waiting)
+	switch msg.String() {
+	case "tab", "esc":
+		m.queueFocus = false
+	case "down", "j":
+		m.queueSel++
+	case "up", "k":
+		m.queueSel--
+	case "J", "shift+down":
+		if m.queueSel < len(waiting)-1 {
+			i := first + m.queueSel
+			m.queue[i], m.queue[i+1] = m.queue[i+1], m.queue[i]
+			m.queueSel++
+		}
+	case "K", "shift+up":
+		if m.queueSel > 0 {
+			i := first + m.queueSel
+			m.queue[i], m.queue[i-1] = m.queue[i-1], m.queue[i]
+			m.queueSel--
+		}
+	case "x", "delete", "backspace":
+		if m.queueSel < len(waiting) {
+			i := first + m.queueSel
+			m.status = "🗑️  Removed " + m.queue[i].name + " from the queue"
+			m.queue = append(m.queue[:i], m.queue[i+1:]...)
+		}
+	case "enter":
+		// Nothing to confirm; keep Enter from queueing the selected file.
+	default:
+		return m, false
+	}
+	return m, true
+}
+
+// queueView lists the queue while there are jobs sending or waiting.
+// Waiting jobs are numbered; the selected one is highlighted while the
+// queue has the focus.
+func (m model) queueView() string {
+	waiting := m.waiting()
+	if len(waiting) == 0 && m.transfer == nil {
+		return ""
+	}
+	title := "📦 Queue"
+	if m.queueFocus {
+		title += "  ↑↓ select, J/K move down/up, x remove, Tab done"
+	} else if len(waiting) > 0 {
+		title += "  Tab to reorder or remove"
+	}
+	lines := []string{title}
+	n := 0
+	for _, j := range m.queue {
+		line := fmt.Sprintf("%s → %s", filepath.Base(j.name), m.peerLabel(j.peer))
+		switch j.state {
+		case jobDone:
+			lines = append(lines, statusStyle.Render("  ✓ "+line))
+		case jobFailed:
+			lines = append(lines, errorStyle.Render("  ✗ "+line+"  "+j.err.Error()))
+		case jobActive:
+			lines = append(lines, "  ▶ "+line)
+		default:
+			n++
+			row := fmt.Sprintf("%d. %s", n, line)
+			if m.queueFocus && n-1 == m.queueSel {
+				lines = append(lines, selectedStyle.Render("👉 "+row))
+			} else {
+				lines = append(lines, "  "+row)
+			}
+		}
+	}
+	return boxStyle.Render(strings.Join(lines, "\n"))
+}
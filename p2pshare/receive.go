@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// downloadDir is where received files are saved, set by -dir.
+var downloadDir = "."
+
+// Conflict policies for an incoming file whose name is already taken.
+const (
+	conflictPrompt    = "prompt"
+	conflictOverwrite = "overwrite"
+	conflictRename    = "rename"
+	conflictSkip      = "skip"
+)
+
+// conflictPolicy is the -on-conflict policy.
+var conflictPolicy = conflictRename
+
+// askName is whether each incoming file's save name is asked for, set by
+// -ask-name.
+var askName = false
+
+// toStdout is whether received files are streamed to stdout instead of
+// being saved, set by -stdout for the headless receiver.
+var toStdout = false
+
+const stdoutUsage = "with receive or -listen, write received files to stdout instead of -dir, logging to stderr"
+
+// streaming is held while a file is written to stdout; files that arrive
+// meanwhile are declined rather than mixed into it.
+var streaming sync.Mutex
+
+// streamStartMsg reports a file starting to stream to stdout.
+type streamStartMsg struct {
+	name string
+	peer string
+	size int64
+}
+
+// promptTimeout is how long a conflict or save name prompt waits for an
+// answer before skipping the file.
+const promptTimeout = time.Minute
+
+// conflictMsg asks the user what to do with an incoming file whose name
+// already exists. The answer, one of the non-prompt policies, is sent on
+// answer.
+type conflictMsg struct {
+	name   string
+	peer   string
+	answer chan<- string
+}
+
+// nameMsg asks the user what to save an incoming file as, suggesting the
+// name the sender gave. The chosen name is sent on answer.
+type nameMsg struct {
+	name   string
+	peer   string
+	size   int64
+	answer chan<- string
+}
+
+// plainName checks that a typed save name is a file name on its own, with
+// no directories that could lead outside the download directory.
+func plainName(name string) error {
+	if clean, err := safeName(name); err != nil || clean != name {
+		return fmt.Errorf("%q is not a plain file name", name)
+	}
+	return nil
+}
+
+// askSaveName asks for the name to save an incoming file as, keeping the
+// suggested one if no valid answer arrives within promptTimeout.
+func askSaveName(name, peer string, size int64, report func(tea.Msg)) string {
+	answer := make(chan string, 1)
+	report(nameMsg{name: name, peer: peer, size: size, answer: answer})
+	select {
+	case chosen := <-answer:
+		if plainName(chosen) == nil {
+			return chosen
+		}
+	case <-time.After(promptTimeout):
+	}
+	return name
+}
+
+// startServer receives files for the TUI, reporting results and conflict
+// prompts through report.
+func startServer(report func(tea.Msg)) {
+	if err := serve(context.Background(), report); err != nil {
+		report(serverErrMsg{err: err})
+	}
+}
+
+// serve accepts transfers until ctx is cancelled, then waits for the ones
+// in progress to finish.
+func serve(ctx context.Context, report func(tea.Msg)) error {
+	var listeners []net.Listener
+	for _, addr := range listenAddrs(transferPort) {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return fmt.Errorf("starting TCP server: %w", err)
+		}
+		listeners = append(listeners, listener)
+	}
+	if len(listeners) == 0 {
+		return fmt.Errorf("starting TCP server: %s has no addresses for -ip %s", bound.iface.Name, ipVersion)
+	}
+	up := serverUpMsg{}
+	for _, l := range listeners {
+		up.addrs = append(up.addrs, l.Addr().String())
+	}
+	report(up)
+	stop := context.AfterFunc(ctx, func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	})
+	defer stop()
+
+	var active sync.WaitGroup
+	defer active.Wait()
+	var accepting sync.WaitGroup
+	for _, listener := range listeners {
+		accepting.Add(1)
+		go func() {
+			defer accepting.Done()
+			defer listener.Close()
+			accept(ctx, listener, &active, report)
+		}()
+	}
+	accepting.Wait()
+	return nil
+}
+
+// accept receives each connection made to listener until ctx is
+// cancelled, counting the receives in progress in active.
+func accept(ctx context.Context, listener net.Listener, active *sync.WaitGroup, report func(tea.Msg)) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		active.Add(1)
+		go func() {
+			defer active.Done()
+			result := receiveFile(conn, report)
+			if result.name == "" && errors.Is(result.err, io.EOF) {
+				// A liveness probe, or a sender that hung up before
+				// sending a header; neither is worth reporting.
+				return
+			}
+			report(result)
+		}()
+	}
+}
+
+// safeName reduces a sender-supplied name to a plain file name so that it
+// cannot escape the download directory.
+func safeName(name string) (string, error) {
+	name = filepath.Base(filepath.Clean(strings.ReplaceAll(name, `\`, "/")))
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		return "", fmt.Errorf("invalid file name %q", name)
+	}
+	return name, nil
+}
+
+// uniquePath returns path, or if it exists, the first free variant of the
+// form "name (n).ext".
+func uniquePath(path string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return path
+		}
+		path = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+}
+
+// resolveConflict decides where to save name, applying the conflict
+// policy if the file already exists. An empty path means skip.
+func resolveConflict(name, peer string, report func(tea.Msg)) string {
+	path := filepath.Join(downloadDir, name)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return path
+	}
+
+	policy := conflictPolicy
+	if policy == conflictPrompt {
+		answer := make(chan string, 1)
+		report(conflictMsg{name: name, peer: peer, answer: answer})
+		select {
+		case policy = <-answer:
+		case <-time.After(promptTimeout):
+			policy = conflictSkip
+		}
+	}
+
+	switch policy {
+	case conflictOverwrite:
+		return path
+	case conflictSkip:
+		return ""
+	default:
+		return uniquePath(path)
+	}
+}
+
+// streamFile copies an incoming file to stdout. Nothing is saved, so a
+// transfer that fails part way, or whose checksum does not match, leaves
+// what already arrived in the stream; the error still says so.
+func streamFile(conn io.Writer, r *bufio.Reader, h header, result transferResultMsg, report func(tea.Msg), decline func(error) transferResultMsg) transferResultMsg {
+	if !streaming.TryLock() {
+		return decline(errors.New("busy streaming another file"))
+	}
+	defer streaming.Unlock()
+	checked := h.Checksum == checksumSHA256
+	if err := json.NewEncoder(conn).Encode(reply{OK: true, Checksum: checked}); err != nil {
+		result.err = fmt.Errorf("accepting file: %w", err)
+		return result
+	}
+	report(streamStartMsg{name: result.name, peer: result.peer, size: result.size})
+	started := time.Now()
+	digest := sha256.New()
+	n, err := io.CopyN(io.MultiWriter(os.Stdout, digest), r, result.size)
+	result.elapsed = time.Since(started)
+	if err != nil {
+		result.err = fmt.Errorf("streaming file: got %d of %d bytes: %w", n, result.size, err)
+		return result
+	}
+	if checked {
+		result.err = checkTrailer(r, digest.Sum(nil))
+		sendVerdict(conn, result.err)
+	}
+	return result
+}
+
+// receiveFile reads one file from conn into the download directory.
+func receiveFile(raw net.Conn, report func(tea.Msg)) transferResultMsg {
+	defer raw.Close()
+	conn := idleConn{Conn: raw, timeout: idleTimeout}
+	result := transferResultMsg{peer: conn.RemoteAddr().String()}
+
+	r := bufio.NewReader(conn)
+	h, err := readHeader(r)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	result.size = h.Size
+
+	decline := func(err error) transferResultMsg {
+		json.NewEncoder(conn).Encode(reply{Error: err.Error()})
+		result.err = err
+		return result
+	}
+
+	name, err := safeName(h.Name)
+	if err != nil {
+		return decline(err)
+	}
+	if toStdout {
+		result.name = name
+		return streamFile(conn, r, h, result, report, decline)
+	}
+	if askName {
+		name = askSaveName(name, result.peer, h.Size, report)
+	}
+	result.name = name
+	path := resolveConflict(name, result.peer, report)
+	if path == "" {
+		return decline(fmt.Errorf("skipped %s: file exists", name))
+	}
+	result.name = filepath.Base(path)
+
+	// The file is written under a temporary name and only renamed into
+	// place once all of it has arrived, so a file with the final name is
+	// always complete.
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.partial")
+	if err != nil {
+		return decline(fmt.Errorf("creating file: %w", err))
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+	chunked := h.Chunk > 0
+	checked := !chunked && h.Checksum == checksumSHA256
+	if err := json.NewEncoder(conn).Encode(reply{OK: true, Chunked: chunked, Checksum: checked}); err != nil {
+		result.err = fmt.Errorf("accepting file: %w", err)
+		return result
+	}
+	if checked {
+		// The sender waits to hear whether the file was verified and saved.
+		defer func() { sendVerdict(conn, result.err) }()
+	}
+
+	started := time.Now()
+	var n int64
+	digest := sha256.New()
+	if chunked {
+		n, err = receiveChunks(conn, r, file, h)
+	} else {
+		n, err = io.CopyN(io.MultiWriter(file, digest), r, h.Size)
+	}
+	result.elapsed = time.Since(started)
+	if err != nil {
+		result.err = fmt.Errorf("receiving file: got %d of %d bytes: %w", n, h.Size, err)
+		return result
+	}
+	if checked {
+		if err := checkTrailer(r, digest.Sum(nil)); err != nil {
+			result.err = err
+			return result
+		}
+	}
+	if err := file.Sync(); err != nil {
+		result.err = fmt.Errorf("saving file: %w", err)
+		return result
+	}
+	if err := file.Close(); err != nil {
+		result.err = fmt.Errorf("saving file: %w", err)
+		return result
+	}
+	// CreateTemp makes the file private; give it the usual permissions.
+	os.Chmod(file.Name(), 0o644)
+	if err := os.Rename(file.Name(), path); err != nil {
+		result.err = fmt.Errorf("saving file: %w", err)
+		return result
+	}
+	committed = true
+	return result
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// simulate is whether sends are only simulated, set by -simulate: no
+// connection is made and the progress is made up, for demos and for
+// trying the UI without a peer.
+var simulate = false
+
+// simulatedPeer is the peer offered with -simulate. It is in a range
+// reserved for documentation, so it is never a real peer.
+const simulatedPeer = "192.0.2.1:9000"
+
+// simulateDuration is how long a simulated send takes, whatever the
+// file's size.
+const simulateDuration = 4 * time.Second
+
+// simulatedNote marks statuses about simulated sends.
+const simulatedNote = " (simulated)"
+
+// simulateSend pretends to send filename, reporting steady progress over
+// simulateDuration. Cancelling ctx stops it with errCancelled.
+func simulateSend(ctx context.Context, filename string, progress progressFunc) (time.Duration, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return 0, fmt.Errorf("opening file: %w", err)
+	}
+	size := info.Size()
+	started := time.Now()
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return time.Since(started), errCancelled
+		case now := <-ticker.C:
+			elapsed := now.Sub(started)
+			done := size
+			if elapsed < simulateDuration {
+				done = int64(float64(size) * elapsed.Seconds() / simulateDuration.Seconds())
+			}
+			if progress != nil {
+				progress(done, size)
+			}
+			if done == size {
+				return elapsed, nil
+			}
+		}
+	}
+}
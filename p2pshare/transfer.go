@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"clifs/shared/units"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/time/rate"
+)
+
+// defaultTransferPort is the TCP port files are received on unless -port
+// says otherwise, and the one peers that do not announce a port use.
+const defaultTransferPort = "9000"
+
+// transferPort is the TCP port this instance receives files on, set by
+// -port.
+var transferPort = defaultTransferPort
+
+// progressInterval is how often a transfer reports its progress.
+const progressInterval = 100 * time.Millisecond
+
+// header precedes the file contents on the wire, encoded as one line of
+// JSON.
+type header struct {
+	Name  string `json:"name"`
+	Size  int64  `json:"size"`
+	Chunk int64  `json:"chunk,omitempty"` // chunk size of a chunked send; see chunks.go
+
+	Checksum string `json:"checksum,omitempty"` // digest offered after the data; see checksum.go
+}
+
+// reply is the receiver's answer to a header, encoded as one line of JSON.
+type reply struct {
+	OK      bool `json:"ok"`
+	Chunked bool `json:"chunked,omitempty"` // the file is to be sent in chunks
+
+	Checksum bool   `json:"checksum,omitempty"` // the digest is to follow the data
+	Error    string `json:"error,omitempty"`
+}
+
+// writeHeader sends h as a single JSON line.
+func writeHeader(w io.Writer, h header) error {
+	return json.NewEncoder(w).Encode(h)
+}
+
+// readHeader reads the JSON header line from r.
+func readHeader(r *bufio.Reader) (header, error) {
+	var h header
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return h, fmt.Errorf("reading header: %w", err)
+	}
+	if err := json.Unmarshal(line, &h); err != nil {
+		return h, fmt.Errorf("invalid header: %w", err)
+	}
+	if h.Size < 0 {
+		return h, fmt.Errorf("invalid header: negative size %d", h.Size)
+	}
+	if h.Chunk < 0 || h.Chunk > maxChunkSize {
+		return h, fmt.Errorf("invalid header: chunk size %d", h.Chunk)
+	}
+	return h, nil
+}
+
+// readReply reads the receiver's JSON reply line from r.
+func readReply(r *bufio.Reader) (reply, error) {
+	var answer reply
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return answer, err
+	}
+	return answer, json.Unmarshal(line, &answer)
+}
+
+// progressFunc is called as a transfer advances with the number of bytes
+// moved so far and the total expected.
+type progressFunc func(done, total int64)
+
+// progressReader counts the bytes read through it and reports them at
+// most once per progressInterval.
+type progressReader struct {
+	r      io.Reader
+	done   int64
+	total  int64
+	last   time.Time
+	report progressFunc
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.done += int64(n)
+	if p.report != nil && time.Since(p.last) >= progressInterval {
+		p.last = time.Now()
+		p.report(p.done, p.total)
+	}
+	return n, err
+}
+
+// dialTimeout bounds connecting to a peer, both for the liveness probe and
+// for the transfer itself.
+var dialTimeout = 2 * time.Second
+
+// idleTimeout is how long a transfer connection may go without data moving
+// before it is dropped, set by -idle-timeout. Zero waits forever.
+var idleTimeout = 30 * time.Second
+
+// idleConn pushes its deadline back on every read and write, so a
+// connection fails once the peer stops responding but an active
+// transfer is never cut off however long it runs.
+type idleConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c idleConn) Read(b []byte) (int, error) {
+	if c.timeout > 0 {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	}
+	return c.Conn.Read(b)
+}
+
+func (c idleConn) Write(b []byte) (int, error) {
+	if c.timeout > 0 {
+		c.Conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	}
+	return c.Conn.Write(b)
+}
+
+// probeMsg reports whether a peer accepted a connection on the transfer port.
+type probeMsg struct {
+	peer string
+	err  error
+}
+
+// lookupHost resolves a peer's hostname; tests replace it so they need no
+// DNS.
+var lookupHost = net.DefaultResolver.LookupHost
+
+// transferAddr is the address files are sent to peer on, as an IP and
+// port. Peer addresses carry the peer's transfer port, as announced in
+// discovery or typed, and one without gets defaultTransferPort. A hostname
+// is resolved here so that an unknown one is reported as such rather than
+// as a failed connection.
+func transferAddr(ctx context.Context, peer string) (string, error) {
+	addr, err := parsePeerAddr(peer)
+	if err != nil {
+		return "", err
+	}
+	host, port, _ := net.SplitHostPort(addr)
+	if _, err := netip.ParseAddr(host); err == nil {
+		return addr, nil
+	}
+	ips, err := lookupHost(ctx, host)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve peer %s: %w", host, err)
+	}
+	return net.JoinHostPort(ips[0], port), nil
+}
+
+// parsePeerAddr validates a typed peer address, an IP or hostname with an
+// optional port, and returns it in the host:port form discovered peers
+// use. The port is the one the peer receives files on and defaults to
+// defaultTransferPort.
+func parsePeerAddr(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", errors.New("enter an IP address or hostname")
+	}
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		// No port, or a bare IPv6 address.
+		host, port = strings.Trim(s, "[]"), defaultTransferPort
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("invalid peer address %q: port %q is not a number from 1 to 65535", s, port)
+	}
+	if _, err := netip.ParseAddr(host); err != nil && !validHostname(host) {
+		return "", fmt.Errorf("invalid peer address %q: %q is not an IP address or hostname", s, host)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// validHostname reports whether s is made of DNS labels.
+func validHostname(s string) bool {
+	if s == "" || len(s) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(s, "."), ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// errSelfSend is returned when the peer is this instance. The receiver
+// saves into the directory the file is read from, so the send would
+// overwrite the file with itself.
+var errSelfSend = errors.New("peer is this instance; sending to yourself would overwrite the file")
+
+// checkNotSelf returns errSelfSend if peer's host resolves to one of the
+// addresses of a local interface, including loopback, and its port is the
+// one this instance receives on. Another instance on the same machine has
+// its own port and -dir, so sending to it is fine.
+func checkNotSelf(peer string) error {
+	host, port, err := net.SplitHostPort(peer)
+	if err != nil {
+		return fmt.Errorf("invalid peer address: %s", peer)
+	}
+	if port != transferPort {
+		return nil
+	}
+	// Link-local addresses carry the interface as a zone, "fe80::1%eth0".
+	ips := []net.IP{net.ParseIP(strings.SplitN(host, "%", 2)[0])}
+	if ips[0] == nil {
+		if ips, err = net.LookupIP(host); err != nil {
+			// Leave the error to the dial, which reports it in context.
+			return nil
+		}
+	}
+	local, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	for _, ip := range ips {
+		if ip.IsLoopback() {
+			return errSelfSend
+		}
+		for _, a := range local {
+			if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+				return errSelfSend
+			}
+		}
+	}
+	return nil
+}
+
+// probePeer checks that the peer is still listening before a file is chosen.
+func probePeer(peer string) tea.Cmd {
+	return func() tea.Msg {
+		if simulate {
+			return probeMsg{peer: peer}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+		defer cancel()
+		addr, err := transferAddr(ctx, peer)
+		if err != nil {
+			return probeMsg{peer: peer, err: err}
+		}
+		conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+		if err != nil {
+			return probeMsg{peer: peer, err: err}
+		}
+		conn.Close()
+		return probeMsg{peer: peer}
+	}
+}
+
+// sendLimit caps outgoing transfers in bytes per second; zero means
+// unlimited. It is set from the -limit flag.
+var sendLimit int64
+
+// parseRate parses a rate such as "512KB", "5MB" or "1.5GB/s" into bytes
+// per second. Units are binary and an empty string means unlimited.
+func parseRate(s string) (int64, error) {
+	s = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "/S")
+	if s == "" {
+		return 0, nil
+	}
+	multiplier := 1.0
+	for _, unit := range []struct {
+		suffix string
+		size   float64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSuffix(s, unit.suffix)
+			multiplier = unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	return int64(n * multiplier), nil
+}
+
+// limitedReader throttles reads to a token bucket. Waiting for tokens
+// stops when ctx is cancelled.
+type limitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+// newLimitedReader wraps r so that it yields at most bytesPerSec.
+func newLimitedReader(ctx context.Context, r io.Reader, bytesPerSec int64) io.Reader {
+	if bytesPerSec <= 0 {
+		return r
+	}
+	// Allow bursts of up to a tenth of a second's worth of data so the
+	// copy runs in reasonably sized chunks.
+	burst := int(bytesPerSec / 10)
+	if burst < 1024 {
+		burst = 1024
+	}
+	return &limitedReader{ctx: ctx, r: r, limiter: rate.NewLimiter(rate.Limit(bytesPerSec), burst)}
+}
+
+func (l *limitedReader) Read(b []byte) (int, error) {
+	if len(b) > l.limiter.Burst() {
+		b = b[:l.limiter.Burst()]
+	}
+	n, err := l.r.Read(b)
+	if n > 0 {
+		if werr := l.limiter.WaitN(l.ctx, n); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
+
+// ctxReader fails reads once ctx is cancelled, so a copy stops at the next
+// chunk even if nothing else interrupts it.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(b []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(b)
+}
+
+// errCancelled is returned by sendFile when its context is cancelled.
+var errCancelled = errors.New("transfer cancelled")
+
+// transferResultMsg reports a finished send or receive.
+type transferResultMsg struct {
+	sent    bool // true for an outgoing transfer
+	name    string
+	peer    string
+	size    int64
+	elapsed time.Duration // from accepting the file to the last byte
+	err     error
+}
+
+// pace describes how long a finished transfer took and its average speed,
+// such as "in 3.2s — 5.7 MB/s".
+func (r transferResultMsg) pace() string {
+	s := "in " + r.elapsed.Round(100*time.Millisecond).String()
+	if secs := r.elapsed.Seconds(); secs > 0 {
+		s += " — " + units.Rate(float64(r.size)/secs)
+	}
+	return s
+}
+
+// serverUpMsg reports the addresses the receiving server is listening on.
+type serverUpMsg struct {
+	addrs []string
+}
+
+// serverErrMsg reports that the receiving server could not start.
+type serverErrMsg struct {
+	err error
+}
+
+// progressMsg reports the progress of the outgoing transfer.
+type progressMsg struct {
+	done  int64
+	total int64
+}
+
+// sendFile sends filename to peer, calling progress as the copy advances,
+// and returns how long the file took to send once the peer accepted it.
+// Cancelling ctx closes the connection, aborting the transfer at any stage,
+// and sendFile returns errCancelled.
+func sendFile(ctx context.Context, filename, peer string, progress progressFunc) (time.Duration, error) {
+	if simulate {
+		return simulateSend(ctx, filename, progress)
+	}
+	elapsed, err := send(ctx, filename, peer, progress)
+	if err != nil && ctx.Err() != nil {
+		return elapsed, errCancelled
+	}
+	return elapsed, err
+}
+
+func send(ctx context.Context, filename, peer string, progress progressFunc) (time.Duration, error) {
+	addr, err := transferAddr(ctx, peer)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkNotSelf(addr); err != nil {
+		return 0, err
+	}
+
+	dialer := net.Dialer{Timeout: dialTimeout}
+	raw, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return 0, fmt.Errorf("connecting to peer: %w", err)
+	}
+	defer raw.Close()
+	stop := context.AfterFunc(ctx, func() { raw.Close() })
+	defer stop()
+	conn := idleConn{Conn: raw, timeout: idleTimeout}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, fmt.Errorf("opening file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("opening file: %w", err)
+	}
+	h := header{Name: filepath.Base(filename), Size: info.Size(), Checksum: checksumSHA256}
+	if chunkedSend {
+		h.Chunk = chunkSize
+	}
+	if err := writeHeader(conn, h); err != nil {
+		return 0, fmt.Errorf("sending header: %w", err)
+	}
+	// The receiver may be asking its user about a name conflict, so the
+	// answer can take up to promptTimeout on top of the usual silence.
+	if idleTimeout > 0 {
+		raw.SetReadDeadline(time.Now().Add(promptTimeout + idleTimeout))
+	}
+	answer, err := readReply(bufio.NewReader(raw))
+	if err != nil {
+		return 0, fmt.Errorf("waiting for peer to accept: %w", err)
+	}
+	if !answer.OK {
+		return 0, fmt.Errorf("peer declined: %s", answer.Error)
+	}
+	started := time.Now()
+	if h.Chunk > 0 && answer.Chunked {
+		err := sendChunks(ctx, conn, bufio.NewReader(conn), file, h.Size, progress)
+		return time.Since(started), err
+	}
+
+	digest := sha256.New()
+	src := newLimitedReader(ctx, ctxReader{ctx: ctx, r: io.TeeReader(file, digest)}, sendLimit)
+	if _, err := io.Copy(conn, &progressReader{r: src, total: h.Size, report: progress}); err != nil {
+		return time.Since(started), fmt.Errorf("sending file: %w", err)
+	}
+	if progress != nil {
+		progress(h.Size, h.Size)
+	}
+	if answer.Checksum {
+		if err := finishChecked(conn, bufio.NewReader(conn), digest.Sum(nil)); err != nil {
+			return time.Since(started), err
+		}
+	}
+	return time.Since(started), nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestParsePeerAddr(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr string
+	}{
+		{in: "192.168.1.5", want: "192.168.1.5:9000"},
+		{in: " 192.168.1.5 ", want: "192.168.1.5:9000"},
+		{in: "192.168.1.5:9100", want: "192.168.1.5:9100"},
+		{in: "laptop", want: "laptop:9000"},
+		{in: "laptop.local:9001", want: "laptop.local:9001"},
+		{in: "::1", want: "[::1]:9000"},
+		{in: "[::1]", want: "[::1]:9000"},
+		{in: "[::1]:9000", want: "[::1]:9000"},
+		{in: "[::1]:9100", want: "[::1]:9100"},
+		{in: "fe80::1%eth0", want: "[fe80::1%eth0]:9000"},
+		{in: "[fe80::1%eth0]", want: "[fe80::1%eth0]:9000"},
+		{in: "[fe80::1%eth0]:9100", want: "[fe80::1%eth0]:9100"},
+		{in: "", wantErr: "enter an IP address or hostname"},
+		{in: "   ", wantErr: "enter an IP address or hostname"},
+		{in: "192.168.1.5:0", wantErr: `invalid peer address "192.168.1.5:0": port "0" is not a number from 1 to 65535`},
+		{in: "192.168.1.5:65536", wantErr: `invalid peer address "192.168.1.5:65536": port "65536" is not a number from 1 to 65535`},
+		{in: "[::1]:0", wantErr: `invalid peer address "[::1]:0": port "0" is not a number from 1 to 65535`},
+		{in: "laptop:http", wantErr: `invalid peer address "laptop:http": port "http" is not a number from 1 to 65535`},
+		{in: "192.168.1.5:", wantErr: `invalid peer address "192.168.1.5:": port "" is not a number from 1 to 65535`},
+		{in: "bad host", wantErr: `invalid peer address "bad host": "bad host" is not an IP address or hostname`},
+		{in: "under_score", wantErr: `invalid peer address "under_score": "under_score" is not an IP address or hostname`},
+		{in: "-laptop", wantErr: `invalid peer address "-laptop": "-laptop" is not an IP address or hostname`},
+		{in: "a..b", wantErr: `invalid peer address "a..b": "a..b" is not an IP address or hostname`},
+		{in: ":9000", wantErr: `invalid peer address ":9000": "" is not an IP address or hostname`},
+		{in: strings.Repeat("a", 64) + ".com", wantErr: `is not an IP address or hostname`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parsePeerAddr(tt.in)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parsePeerAddr(%q) = %q, %v; want error %q", tt.in, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("parsePeerAddr(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransferAddr(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr string
+	}{
+		{in: "192.168.1.5", want: "192.168.1.5:9000"},
+		{in: "192.168.1.5:9100", want: "192.168.1.5:9100"},
+		{in: "::1", want: "[::1]:9000"},
+		{in: "[::1]:9100", want: "[::1]:9100"},
+		{in: "fe80::1%eth0", want: "[fe80::1%eth0]:9000"},
+		{in: "peer.test:9100", want: "192.0.2.7:9100"},
+		{in: "192.168.1.5:0", wantErr: `port "0" is not a number from 1 to 65535`},
+		{in: "bad host", wantErr: `"bad host" is not an IP address or hostname`},
+		{in: "no-such-host.invalid", wantErr: "cannot resolve peer no-such-host.invalid"},
+	}
+	defer func(orig func(context.Context, string) ([]string, error)) { lookupHost = orig }(lookupHost)
+	lookupHost = func(_ context.Context, host string) ([]string, error) {
+		if host == "peer.test" {
+			return []string{"192.0.2.7"}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := transferAddr(context.Background(), tt.in)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("transferAddr(%q) = %q, %v; want error %q", tt.in, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("transferAddr(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+// Package notify shows desktop notifications through the platform's own
+// notification command, and decides when an alert is worth one.
+package notify
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// timeout bounds how long the notification command may run. The Windows
+// one waits for its balloon to show before exiting.
+const timeout = 15 * time.Second
+
+// The AppleScript and PowerShell commands read the title and body from
+// the environment, so neither needs quoting for their languages.
+const (
+	darwinScript  = `display notification (system attribute "CLIFS_NOTIFY_BODY") with title (system attribute "CLIFS_NOTIFY_TITLE")`
+	windowsScript = `Add-Type -AssemblyName System.Windows.Forms; ` +
+		`$n = New-Object System.Windows.Forms.NotifyIcon; ` +
+		`$n.Icon = [System.Drawing.SystemIcons]::Information; $n.Visible = $true; ` +
+		`$n.ShowBalloonTip(5000, $env:CLIFS_NOTIFY_TITLE, $env:CLIFS_NOTIFY_BODY, 'Info'); ` +
+		`Start-Sleep -Seconds 6; $n.Dispose()`
+)
+
+// Send shows a notification with title and body: with osascript on macOS,
+// PowerShell on Windows and notify-send elsewhere. It blocks until the
+// command exits, so callers in a UI run it in the background.
+func Send(title, body string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.CommandContext(ctx, "osascript", "-e", darwinScript)
+	case "windows":
+		cmd = exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", windowsScript)
+	default:
+		cmd = exec.CommandContext(ctx, "notify-send", "--app-name=clifs", title, body)
+	}
+	cmd.Env = append(os.Environ(), "CLIFS_NOTIFY_TITLE="+title, "CLIFS_NOTIFY_BODY="+body)
+	return cmd.Run()
+}
+
+// Alert debounces one alert condition, such as CPU usage over a threshold,
+// which is checked on every refresh. It asks for one notification each
+// time the condition starts holding, not one per refresh. The zero value
+// notifies as soon as the condition holds.
+type Alert struct {
+	// For is how long the condition must hold before notifying, so brief
+	// spikes are ignored.
+	For time.Duration
+	// Quiet is the least time between two notifications, so a reading that
+	// keeps crossing its threshold does not notify on every crossing.
+	Quiet time.Duration
+
+	since    time.Time // when the condition started holding; zero while it does not
+	notified bool      // whether this spell of the condition was notified
+	last     time.Time // the last notification
+}
+
+// Update records whether the condition holds at now and reports whether to
+// notify about it.
+func (a *Alert) Update(now time.Time, holds bool) bool {
+	if !holds {
+		a.since, a.notified = time.Time{}, false
+		return false
+	}
+	if a.since.IsZero() {
+		a.since = now
+	}
+	if a.notified || now.Sub(a.since) < a.For || !a.last.IsZero() && now.Sub(a.last) < a.Quiet {
+		return false
+	}
+	a.notified, a.last = true, now
+	return true
+}
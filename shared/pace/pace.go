@@ -0,0 +1,70 @@
+// Package pace slows a refresh interval down while nothing is happening
+// and speeds it back up when activity resumes.
+package pace
+
+import "time"
+
+// Pacer chooses the interval until the next refresh, starting at Min.
+type Pacer struct {
+	Min, Max  time.Duration // bounds of the interval
+	IdleAfter time.Duration // quiet time before slowing down
+
+	interval   time.Duration
+	quietSince time.Time
+}
+
+// Observe records whether the latest sample showed activity and returns
+// the interval to wait before the next one. After IdleAfter without
+// activity the interval doubles on each call, up to Max.
+func (p *Pacer) Observe(now time.Time, active bool) time.Duration {
+	switch {
+	case active || p.quietSince.IsZero():
+		p.interval = p.Min
+		p.quietSince = now
+	case now.Sub(p.quietSince) >= p.IdleAfter:
+		p.interval = min(p.Interval()*2, p.Max)
+	}
+	return p.Interval()
+}
+
+// Reset returns to the fastest interval, as if activity had just been seen.
+func (p *Pacer) Reset(now time.Time) {
+	p.interval = p.Min
+	p.quietSince = now
+}
+
+// Bounds of Min when it is changed with Faster and Slower.
+const (
+	Fastest = 100 * time.Millisecond
+	Slowest = 10 * time.Minute
+)
+
+// Faster halves Min and Max, stopping at Fastest, and returns to the new
+// Min straight away.
+func (p *Pacer) Faster(now time.Time) {
+	p.scale(now, max(p.Min/2, Fastest))
+}
+
+// Slower doubles Min and Max, stopping at Slowest.
+func (p *Pacer) Slower(now time.Time) {
+	p.scale(now, min(p.Min*2, Slowest))
+}
+
+// scale sets Min to newMin and scales Max by the same factor, so the
+// amount of slowing down while idle is kept.
+func (p *Pacer) scale(now time.Time, newMin time.Duration) {
+	if p.Min > 0 {
+		p.Max = time.Duration(float64(p.Max) * float64(newMin) / float64(p.Min))
+	}
+	p.Min = newMin
+	p.Max = max(p.Max, p.Min)
+	p.Reset(now)
+}
+
+// Interval is the current interval.
+func (p *Pacer) Interval() time.Duration {
+	if p.interval < p.Min {
+		return p.Min
+	}
+	return p.interval
+}
@@ -0,0 +1,40 @@
+package rate
+
+// EWMA is an exponentially weighted moving average, which smooths a
+// jittery series of rates while still following lasting changes. The zero
+// value is unusable; set Alpha.
+type EWMA struct {
+	// Alpha is the weight of each new value, above 0 and at most 1. Higher
+	// values follow changes faster and smooth less.
+	Alpha float64
+
+	value  float64
+	primed bool
+}
+
+// Add folds v into the average and returns the new average. The first
+// value is taken as it is.
+func (e *EWMA) Add(v float64) float64 {
+	if !e.primed {
+		e.value, e.primed = v, true
+	} else {
+		e.value += e.Alpha * (v - e.value)
+	}
+	return e.value
+}
+
+// Value returns the current average, zero before the first Add.
+func (e *EWMA) Value() float64 {
+	return e.value
+}
+
+// Smooth returns the moving average of values after each one, for drawing
+// a history as it would have looked smoothed.
+func Smooth(values []float64, alpha float64) []float64 {
+	e := EWMA{Alpha: alpha}
+	out := make([]float64, len(values))
+	for i, v := range values {
+		out[i] = e.Add(v)
+	}
+	return out
+}
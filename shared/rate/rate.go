@@ -0,0 +1,92 @@
+// Package rate turns cumulative counters, such as bytes sent or disk reads,
+// into per-second rates.
+package rate
+
+import (
+	"math"
+	"time"
+)
+
+// Tracker remembers the previous reading of a set of counters so that the
+// next reading can be turned into rates.
+type Tracker struct {
+	// CounterBits is the width of the counters, 32 or 64, which decides
+	// whether a counter that went backwards wrapped or was reset. Zero
+	// guesses per reading; see Delta.
+	CounterBits int
+
+	prev map[string][]uint64
+	at   time.Time
+}
+
+// Update records readings taken at now, one slice of counters per key, and
+// returns the per-second rate of each counter since the previous reading.
+// Keys without a previous reading are absent from the result, as are keys
+// whose counters went backwards without wrapping, which means the device
+// was reset. now should be when the counters were read rather than when
+// they are handled, so that readings delivered late still divide by the
+// real time between them.
+func (t *Tracker) Update(now time.Time, readings map[string][]uint64) map[string][]float64 {
+	rates := make(map[string][]float64, len(readings))
+	elapsed := now.Sub(t.at).Seconds()
+	for key, cur := range readings {
+		prev, ok := t.prev[key]
+		if !ok || elapsed <= 0 || len(prev) != len(cur) {
+			continue
+		}
+		r, ok := t.perSecond(prev, cur, elapsed)
+		if ok {
+			rates[key] = r
+		}
+	}
+	t.prev = readings
+	t.at = now
+	return rates
+}
+
+// perSecond computes the rate of each counter over elapsed seconds.
+func (t *Tracker) perSecond(prev, cur []uint64, elapsed float64) ([]float64, bool) {
+	r := make([]float64, len(cur))
+	for i := range cur {
+		d, ok := Delta(prev[i], cur[i], t.CounterBits)
+		if !ok {
+			return nil, false
+		}
+		r[i] = float64(d) / elapsed
+	}
+	return r, true
+}
+
+// max32 is the largest value of a 32-bit counter.
+const max32 = 1<<32 - 1
+
+// Delta returns how far a counter moved from prev to cur, and false if it
+// was reset. With bits 32 a counter that went backwards is taken to have
+// wrapped once. With bits zero a wrap is assumed when the counter fits in
+// 32 bits and went from the upper half of the range to the lower half, as
+// 32-bit counters on busy interfaces do every few seconds to minutes;
+// other drops look like a reset. A 64-bit counter, with bits 64 or one
+// too big for 32 bits, is taken to have wrapped only when it went from the
+// upper half of its range to the lower half, and to have been reset
+// otherwise.
+func Delta(prev, cur uint64, bits int) (uint64, bool) {
+	if cur >= prev {
+		return cur - prev, true
+	}
+	if prev > max32 || bits == 64 {
+		if prev > math.MaxUint64/2 && cur <= math.MaxUint64/2 {
+			return math.MaxUint64 - prev + cur + 1, true
+		}
+		return 0, false
+	}
+	switch bits {
+	case 32:
+	case 0:
+		if prev <= max32/2 || cur > max32/2 {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	return max32 - prev + cur + 1, true
+}
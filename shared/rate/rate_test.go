@@ -0,0 +1,103 @@
+package rate
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDelta(t *testing.T) {
+	tests := []struct {
+		name      string
+		prev, cur uint64
+		bits      int
+		want      uint64
+		wantOK    bool
+	}{
+		{"forward", 100, 250, 0, 150, true},
+		{"unchanged", 100, 100, 64, 0, true},
+		{"32-bit wrap", max32 - 9, 5, 32, 15, true},
+		{"32-bit wrap guessed", max32 - 9, 5, 0, 15, true},
+		{"32-bit drop from the lower half is a reset", 1000, 5, 0, 0, false},
+		{"32-bit drop into the upper half is a reset", max32 - 9, max32 - 100, 0, 0, false},
+		{"64-bit wrap", math.MaxUint64 - 9, 5, 64, 15, true},
+		{"64-bit wrap guessed", math.MaxUint64 - 9, 5, 0, 15, true},
+		{"64-bit reset", 5 << 40, 1000, 64, 0, false},
+		{"64-bit reset guessed", 5 << 40, 1000, 0, 0, false},
+		{"small counter with bits 64 is a reset", 1000, 5, 64, 0, false},
+		{"unknown width is a reset", max32 - 9, 5, 16, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Delta(tt.prev, tt.cur, tt.bits)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Delta(%d, %d, %d) = %d, %v; want %d, %v", tt.prev, tt.cur, tt.bits, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestTrackerAcrossWrap(t *testing.T) {
+	for _, bits := range []int{0, 32} {
+		tr := &Tracker{CounterBits: bits}
+		start := time.Unix(1000, 0)
+		counter := uint64(max32 - 2500)
+		for i := 0; i < 6; i++ {
+			rates := tr.Update(start.Add(time.Duration(i)*time.Second), map[string][]uint64{"eth0": {counter}})
+			if i == 0 {
+				if len(rates) != 0 {
+					t.Fatalf("bits %d: first reading gave rates %v, want none", bits, rates)
+				}
+			} else if r, ok := rates["eth0"]; !ok || r[0] != 1000 {
+				t.Errorf("bits %d: reading %d gave %v, want 1000/s", bits, i, rates)
+			}
+			counter = (counter + 1000) & max32
+		}
+	}
+}
+
+func TestTrackerReset(t *testing.T) {
+	tr := &Tracker{}
+	start := time.Unix(1000, 0)
+	tr.Update(start, map[string][]uint64{"eth0": {5 << 40}})
+	if rates := tr.Update(start.Add(time.Second), map[string][]uint64{"eth0": {1000}}); len(rates) != 0 {
+		t.Errorf("reset counter gave rates %v, want none", rates)
+	}
+	rates := tr.Update(start.Add(2*time.Second), map[string][]uint64{"eth0": {3000}})
+	if r := rates["eth0"]; len(r) != 1 || r[0] != 2000 {
+		t.Errorf("reading after the reset gave %v, want 2000/s", rates)
+	}
+}
+
+func TestTrackerUnevenIntervals(t *testing.T) {
+	tr := &Tracker{}
+	start := time.Unix(1000, 0)
+	steps := []struct {
+		after   time.Duration
+		counter uint64
+		want    float64
+	}{
+		{500 * time.Millisecond, 1000, 2000}, // 1000 bytes in half a second
+		{2 * time.Second, 5000, 2000},        // 4000 bytes in two seconds
+		{2 * time.Second, 6000, 500},
+		{500 * time.Millisecond, 6000, 0},
+	}
+	tr.Update(start, map[string][]uint64{"eth0": {0}})
+	at := start
+	for i, step := range steps {
+		at = at.Add(step.after)
+		rates := tr.Update(at, map[string][]uint64{"eth0": {step.counter}})
+		if r := rates["eth0"]; len(r) != 1 || math.Abs(r[0]-step.want) > 1e-9 {
+			t.Errorf("step %d, %s after the last: rates %v, want %v/s", i, step.after, rates, step.want)
+		}
+	}
+}
+
+func TestTrackerSameInstant(t *testing.T) {
+	tr := &Tracker{}
+	at := time.Unix(1000, 0)
+	tr.Update(at, map[string][]uint64{"eth0": {0}})
+	if rates := tr.Update(at, map[string][]uint64{"eth0": {1000}}); len(rates) != 0 {
+		t.Errorf("readings at the same instant gave rates %v, want none", rates)
+	}
+}
@@ -0,0 +1,276 @@
+// Package theme loads the colour palette shared by the clifs tools.
+package theme
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Palette holds the hex colours used by the tools' styles.
+type Palette struct {
+	Text     string `json:"text"`     // plain foreground text
+	Title    string `json:"title"`    // title banner background
+	Accent   string `json:"accent"`   // headings and highlights
+	Selected string `json:"selected"` // selected list row
+	Success  string `json:"success"`  // list items and good news
+	Info     string `json:"info"`     // status messages
+	Error    string `json:"error"`    // errors
+	Muted    string `json:"muted"`    // footers and hints
+	BarBase  string `json:"bar_base"` // empty part of a bar
+	CPU      string `json:"cpu"`      // CPU bar fill
+	Mem      string `json:"mem"`      // memory bar fill
+	Disk     string `json:"disk"`     // disk bar fill
+	Sent     string `json:"sent"`     // network sent bar fill
+	Recv     string `json:"recv"`     // network received bar fill
+
+	// Patterned bars use a different fill character for each series, so
+	// they can be told apart without relying on colour.
+	Patterned bool `json:"patterned"`
+}
+
+// Dark is the default palette.
+func Dark() Palette {
+	return Palette{
+		Text:     "#FAFAFA",
+		Title:    "#7D56F4",
+		Accent:   "#FFB86C",
+		Selected: "#FF79C6",
+		Success:  "#50FA7B",
+		Info:     "#8BE9FD",
+		Error:    "#FF5555",
+		Muted:    "#6272A4",
+		BarBase:  "#333333",
+		CPU:      "#FF4757",
+		Mem:      "#2ED573",
+		Disk:     "#1E90FF",
+		Sent:     "#FFB86C",
+		Recv:     "#8BE9FD",
+	}
+}
+
+// Light is a palette for terminals with a light background.
+func Light() Palette {
+	return Palette{
+		Text:     "#1F1F1F",
+		Title:    "#5A3FC0",
+		Accent:   "#B35C00",
+		Selected: "#C2185B",
+		Success:  "#1B7F3B",
+		Info:     "#00708A",
+		Error:    "#C62828",
+		Muted:    "#6B6B8A",
+		BarBase:  "#DDDDDD",
+		CPU:      "#D32F2F",
+		Mem:      "#2E7D32",
+		Disk:     "#1565C0",
+		Sent:     "#E65100",
+		Recv:     "#00838F",
+	}
+}
+
+// Colorblind is the dark palette with the colorblind override applied.
+func Colorblind() Palette {
+	p, _ := Override(Dark(), "colorblind")
+	return p
+}
+
+// Basic maps every colour of p to the closest of the 16 basic terminal
+// colours by hue and lightness, for terminals without 256 colours. Nearest
+// value matching, which the terminal libraries fall back to, tends to turn
+// mid-tones into greys; keeping the hue keeps the roles apart.
+func (p Palette) Basic() Palette {
+	for _, c := range []*string{&p.Text, &p.Title, &p.Accent, &p.Selected, &p.Success, &p.Info,
+		&p.Error, &p.Muted, &p.BarBase, &p.CPU, &p.Mem, &p.Disk, &p.Sent, &p.Recv} {
+		*c = basicColor(*c)
+	}
+	return p
+}
+
+// basicColor returns the ANSI index, "0" to "15", closest to a hex colour.
+// Anything that is not a hex colour is returned unchanged.
+func basicColor(hex string) string {
+	if !hexColor.MatchString(hex) {
+		return hex
+	}
+	digits := hex[1:]
+	if len(digits) == 3 {
+		digits = string([]byte{digits[0], digits[0], digits[1], digits[1], digits[2], digits[2]})
+	}
+	var rgb [3]float64
+	for i := range rgb {
+		var v int
+		fmt.Sscanf(digits[2*i:2*i+2], "%02x", &v)
+		rgb[i] = float64(v) / 255
+	}
+	r, g, b := rgb[0], rgb[1], rgb[2]
+	hi, lo := max(r, g, b), min(r, g, b)
+	light := (hi + lo) / 2
+	sat := 0.0
+	if hi > lo {
+		sat = (hi - lo) / (1 - math.Abs(2*light-1))
+	}
+	if sat < 0.3 {
+		switch {
+		case light < 0.15:
+			return "0"
+		case light < 0.5:
+			return "8"
+		case light < 0.9:
+			return "7"
+		}
+		return "15"
+	}
+
+	var hue float64
+	switch hi {
+	case r:
+		hue = math.Mod((g-b)/(hi-lo)*60+360, 360)
+	case g:
+		hue = (b-r)/(hi-lo)*60 + 120
+	default:
+		hue = (r-g)/(hi-lo)*60 + 240
+	}
+	// ANSI order is black, red, green, yellow, blue, magenta, cyan, white;
+	// these are the colours around the hue circle from red.
+	index := []int{1, 3, 2, 6, 4, 5, 1}[int(hue+30)/60]
+	if light > 0.55 {
+		index += 8
+	}
+	return strconv.Itoa(index)
+}
+
+// builtin maps theme names to their palettes.
+var builtin = map[string]func() Palette{
+	"dark":       Dark,
+	"light":      Light,
+	"colorblind": Colorblind,
+}
+
+// Override applies a -palette name to p. "colorblind" replaces the
+// red/green pairs with blue/orange ones that stay distinct with the common
+// forms of colour blindness, and turns on patterned bars; the remaining
+// colours, such as the background-dependent text, are kept. An empty name
+// leaves p unchanged.
+func Override(p Palette, name string) (Palette, error) {
+	switch strings.ToLower(name) {
+	case "":
+		return p, nil
+	case "colorblind":
+		// From the Okabe-Ito palette.
+		p.Success = "#56B4E9"
+		p.Error = "#E69F00"
+		p.CPU = "#D55E00"
+		p.Mem = "#0072B2"
+		p.Disk = "#F0E442"
+		p.Sent = "#E69F00"
+		p.Recv = "#56B4E9"
+		p.Patterned = true
+		return p, nil
+	}
+	return p, fmt.Errorf("palette: unknown palette %q (want colorblind)", name)
+}
+
+// file is the on-disk theme format. Base names a built-in theme the
+// colours are layered over; any colour left empty keeps the base value.
+type file struct {
+	Base string `json:"base"`
+	Palette
+}
+
+var hexColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// NoColor reports whether the environment asks for output without colour:
+// NO_COLOR is set to anything (see https://no-color.org), or TERM is
+// "dumb".
+func NoColor() bool {
+	return os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb"
+}
+
+// DefaultPath returns ~/.config/clifs/theme.json.
+func DefaultPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "clifs", "theme.json")
+}
+
+// Load resolves spec to a palette. spec may be the name of a built-in
+// theme, a path to a theme file, or empty to use the default file if it
+// exists. Load never fails: problems are returned as warnings and the
+// affected colours fall back to the dark theme.
+func Load(spec string) (Palette, []error) {
+	if fn, ok := builtin[strings.ToLower(spec)]; ok {
+		return fn(), nil
+	}
+
+	path := spec
+	if path == "" {
+		path = DefaultPath()
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if spec == "" && errors.Is(err, os.ErrNotExist) {
+			return Dark(), nil
+		}
+		return Dark(), []error{fmt.Errorf("theme: %w", err)}
+	}
+
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return Dark(), []error{fmt.Errorf("theme: %s: %w", path, err)}
+	}
+
+	var warnings []error
+	base := Dark()
+	if f.Base != "" {
+		if fn, ok := builtin[strings.ToLower(f.Base)]; ok {
+			base = fn()
+		} else {
+			warnings = append(warnings, fmt.Errorf("theme: %s: unknown base theme %q", path, f.Base))
+		}
+	}
+	return merge(base, f.Palette, path, warnings)
+}
+
+// merge overlays the non-empty, valid colours of p onto base.
+func merge(base, p Palette, path string, warnings []error) (Palette, []error) {
+	fields := []struct {
+		name     string
+		dst, src *string
+	}{
+		{"text", &base.Text, &p.Text},
+		{"title", &base.Title, &p.Title},
+		{"accent", &base.Accent, &p.Accent},
+		{"selected", &base.Selected, &p.Selected},
+		{"success", &base.Success, &p.Success},
+		{"info", &base.Info, &p.Info},
+		{"error", &base.Error, &p.Error},
+		{"muted", &base.Muted, &p.Muted},
+		{"bar_base", &base.BarBase, &p.BarBase},
+		{"cpu", &base.CPU, &p.CPU},
+		{"mem", &base.Mem, &p.Mem},
+		{"disk", &base.Disk, &p.Disk},
+		{"sent", &base.Sent, &p.Sent},
+		{"recv", &base.Recv, &p.Recv},
+	}
+	for _, f := range fields {
+		if *f.src == "" {
+			continue
+		}
+		if !hexColor.MatchString(*f.src) {
+			warnings = append(warnings, fmt.Errorf("theme: %s: %s: invalid hex colour %q", path, f.name, *f.src))
+			continue
+		}
+		*f.dst = *f.src
+	}
+	base.Patterned = base.Patterned || p.Patterned
+	return base, warnings
+}
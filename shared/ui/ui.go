@@ -0,0 +1,131 @@
+// Package ui holds the bar and sparkline rendering shared by the clifs
+// monitors.
+package ui
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// BarBase wraps every bar; its background shows through the empty cells.
+// EmptyChar, when set, draws the empty cells instead, for terminals where
+// background colours render poorly.
+var (
+	BarBase   = lipgloss.NewStyle()
+	EmptyChar = ""
+)
+
+// Plain turns off colours and text attributes in everything lipgloss
+// renders, for NO_COLOR and dumb terminals.
+func Plain() {
+	lipgloss.SetColorProfile(termenv.Ascii)
+}
+
+// BasicColors reports whether the terminal only has the 16 basic colours,
+// in which case palettes should be reduced with theme.Palette.Basic. With
+// 256 colours the automatic conversion is close enough.
+func BasicColors() bool {
+	return lipgloss.ColorProfile() == termenv.ANSI
+}
+
+// Filled returns how many of width cells value fills when max fills them
+// all, clamped to [0, width]. Any positive value overflows a max of zero
+// or less and fills the bar; a NaN fills none of it.
+func Filled(value, max float64, width int) int {
+	if !(value > 0) || width <= 0 || max != max { // also catches NaN
+		return 0
+	}
+	if max <= 0 || value >= max {
+		return width
+	}
+	return int(value / max * float64(width))
+}
+
+// Bar renders value out of max as a bar width cells wide, drawing the
+// filled cells as blanks with style, which should set a background.
+func Bar(value, max float64, width int, style lipgloss.Style) string {
+	return PatternBar(value, max, width, style, "")
+}
+
+// PatternBar is Bar with the filled cells drawn as fill, so that bars can
+// be told apart by texture as well as colour. An empty fill is Bar.
+func PatternBar(value, max float64, width int, style lipgloss.Style, fill string) string {
+	if width < 0 {
+		width = 0
+	}
+	n := Filled(value, max, width)
+	filled := style.Width(n).Render("")
+	if fill != "" {
+		filled = style.Render(strings.Repeat(fill, n))
+	}
+	empty := lipgloss.NewStyle().Width(width - n).Render("")
+	if EmptyChar != "" {
+		empty = strings.Repeat(EmptyChar, width-n)
+	}
+	return BarBase.Render(filled + empty)
+}
+
+// Threshold picks the style for a percentage: crit at or above critAt,
+// warn at or above warnAt, and normal below.
+func Threshold(percent, warnAt, critAt float64, normal, warn, crit lipgloss.Style) lipgloss.Style {
+	switch {
+	case percent >= critAt:
+		return crit
+	case percent >= warnAt:
+		return warn
+	}
+	return normal
+}
+
+// sparkLevels are the glyphs used by Sparkline, lowest first.
+var sparkLevels = []rune("▁▂▃▄▅▆▇█")
+
+// Sparkline draws values scaled to their own maximum, at most width
+// columns wide.
+func Sparkline(values []float64, width int) string {
+	values = Downsample(values, width)
+	var peak float64
+	for _, v := range values {
+		if v > peak {
+			peak = v
+		}
+	}
+	return SparklineScaled(values, width, peak)
+}
+
+// SparklineScaled draws values on a fixed scale from zero to peak, at most
+// width columns wide, such as 0-100 for percentages. Values outside the
+// scale are clamped.
+func SparklineScaled(values []float64, width int, peak float64) string {
+	values = Downsample(values, width)
+	spark := make([]rune, len(values))
+	top := len(sparkLevels) - 1
+	for i, v := range values {
+		level := 0
+		if peak > 0 && v > 0 {
+			level = min(int(v/peak*float64(top)), top)
+		}
+		spark[i] = sparkLevels[level]
+	}
+	return string(spark)
+}
+
+// Downsample reduces values to at most n points, keeping the peak of each
+// bucket so short spikes stay visible.
+func Downsample(values []float64, n int) []float64 {
+	if n <= 0 || len(values) <= n {
+		return values
+	}
+	out := make([]float64, n)
+	for i := range out {
+		start, end := i*len(values)/n, (i+1)*len(values)/n
+		for _, v := range values[start:end] {
+			if v > out[i] {
+				out[i] = v
+			}
+		}
+	}
+	return out
+}
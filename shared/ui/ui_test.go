@@ -0,0 +1,72 @@
+package ui
+
+import (
+	"math"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+func TestFilled(t *testing.T) {
+	tests := []struct {
+		name  string
+		value float64
+		max   float64
+		width int
+		want  int
+	}{
+		{"empty", 0, 100, 20, 0},
+		{"negative", -5, 100, 20, 0},
+		{"half", 50, 100, 20, 10},
+		{"rounds down", 99, 100, 20, 19},
+		{"full", 100, 100, 20, 20},
+		{"over max", 250, 100, 20, 20},
+		{"zero max", 5, 0, 20, 20},
+		{"zero max and value", 0, 0, 20, 0},
+		{"negative max", 5, -1, 20, 20},
+		{"zero width", 50, 100, 0, 0},
+		{"negative width", 50, 100, -3, 0},
+		{"NaN value", math.NaN(), 100, 20, 0},
+		{"NaN max", 50, math.NaN(), 20, 0},
+		{"infinite value", math.Inf(1), 100, 20, 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Filled(tt.value, tt.max, tt.width); got != tt.want {
+				t.Errorf("Filled(%v, %v, %d) = %d, want %d", tt.value, tt.max, tt.width, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBarWidth(t *testing.T) {
+	lipgloss.SetColorProfile(termenv.Ascii)
+	style := lipgloss.NewStyle()
+	for _, value := range []float64{0, 50, 100, 1000} {
+		if got := lipgloss.Width(Bar(value, 100, 20, style)); got != 20 {
+			t.Errorf("Bar(%v, 100, 20) is %d cells wide, want 20", value, got)
+		}
+	}
+}
+
+func TestPatternBar(t *testing.T) {
+	lipgloss.SetColorProfile(termenv.Ascii)
+	defer func(empty string) { EmptyChar = empty }(EmptyChar)
+	EmptyChar = "-"
+	style := lipgloss.NewStyle()
+	tests := []struct {
+		value float64
+		want  string
+	}{
+		{0, "----------"},
+		{30, "###-------"},
+		{100, "##########"},
+		{150, "##########"},
+	}
+	for _, tt := range tests {
+		if got := PatternBar(tt.value, 100, 10, style, "#"); got != tt.want {
+			t.Errorf("PatternBar(%v, 100, 10) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
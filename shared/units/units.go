@@ -0,0 +1,39 @@
+// Package units formats byte counts and rates for display.
+package units
+
+import "fmt"
+
+// Bytes formats n bytes using binary units, e.g. "1.5 MB".
+func Bytes(n float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
+
+// Rate formats a rate in bytes per second, e.g. "1.5 MB/s".
+func Rate(bytesPerSec float64) string {
+	return Bytes(bytesPerSec) + "/s"
+}
+
+// Bits formats a rate in bytes per second as bits per second using SI
+// (1000-based) units, e.g. "12.0 Mb/s".
+func Bits(bytesPerSec float64) string {
+	n := bytesPerSec * 8
+	units := []string{"b/s", "kb/s", "Mb/s", "Gb/s", "Tb/s"}
+	i := 0
+	for n >= 1000 && i < len(units)-1 {
+		n /= 1000
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
@@ -0,0 +1,59 @@
+// Package version reports which build of a tool is running.
+//
+// Release builds set the values with -ldflags, e.g.
+//
+//	go build -ldflags "-X clifs/shared/version.Version=v1.2.0 \
+//		-X clifs/shared/version.Commit=$(git rev-parse HEAD) \
+//		-X clifs/shared/version.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Anything left unset is filled in from the Go build info.
+package version
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// Set with -ldflags -X; empty values fall back to the build info.
+var (
+	Version string
+	Commit  string
+	Date    string
+)
+
+// String describes the build of the named tool, e.g.
+// "sys-monitor v1.2.0 (commit 1a2b3c4, built 2024-05-01T10:00:00Z)".
+func String(name string) string {
+	version, commit, date := Version, Commit, Date
+	dirty := false
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if version == "" && info.Main.Version != "" {
+			version = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && commit == "":
+				commit = s.Value
+			case s.Key == "vcs.time" && date == "":
+				date = s.Value
+			case s.Key == "vcs.modified" && s.Value == "true" && Commit == "":
+				dirty = true
+			}
+		}
+	}
+	if version == "" {
+		version = "(devel)"
+	}
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	if commit == "" {
+		commit = "unknown"
+	} else if dirty {
+		commit += "-dirty"
+	}
+	if date == "" {
+		date = "unknown"
+	}
+	return fmt.Sprintf("%s %s (commit %s, built %s)", name, version, commit, date)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"clifs/shared/notify"
+	"clifs/shared/units"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Alerts that -notify shows desktop notifications for, indexing
+// Model.alerts.
+const (
+	alertCPU = iota
+	alertMem
+	alertDisk
+	numAlerts
+)
+
+// cpuAlertFor is how long CPU usage must stay over -cpu-alert before it
+// notifies, as busy moments are normal.
+const cpuAlertFor = 30 * time.Second
+
+// alertQuiet is the least time between two notifications for the same
+// alert.
+const alertQuiet = 10 * time.Minute
+
+// notifiedMsg reports the outcome of showing a notification.
+type notifiedMsg struct {
+	err error
+}
+
+// newAlerts returns the debouncers for the alerts.
+func newAlerts() [numAlerts]notify.Alert {
+	var alerts [numAlerts]notify.Alert
+	for i := range alerts {
+		alerts[i].Quiet = alertQuiet
+	}
+	alerts[alertCPU].For = cpuAlertFor
+	return alerts
+}
+
+// checkAlerts updates the alerts with the latest sample and returns a
+// command showing a notification for each one that should, or nil when
+// -notify is off.
+func (m *Model) checkAlerts(now time.Time) tea.Cmd {
+	if !*notifyFlag {
+		return nil
+	}
+	var cmds []tea.Cmd
+	if m.alerts[alertCPU].Update(now, m.hasCPU && m.cpuUsage >= *cpuAlertFlag) {
+		cmds = append(cmds, notifyCmd("High CPU usage", fmt.Sprintf("CPU has been at %.0f%% or more for %s; now %.1f%%", *cpuAlertFlag, cpuAlertFor, m.cpuUsage)))
+	}
+	if m.alerts[alertMem].Update(now, m.memoryTotal > 0 && m.memoryUsage >= *memAlertFlag) {
+		cmds = append(cmds, notifyCmd("High memory usage", fmt.Sprintf("Memory is %.1f%% used", m.memoryUsage)))
+	}
+	if m.alerts[alertDisk].Update(now, m.diskTotal > 0 && m.diskUsage >= *diskCriticalFlag) {
+		cmds = append(cmds, notifyCmd("Disk nearly full", fmt.Sprintf("%s is %.1f%% used, %s free", *diskFlag, m.diskUsage, units.Bytes(float64(m.diskFree)))))
+	}
+	return tea.Batch(cmds...)
+}
+
+// notifyCmd shows a notification in the background.
+func notifyCmd(title, body string) tea.Cmd {
+	return func() tea.Msg {
+		return notifiedMsg{err: notify.Send("sys-monitor: "+title, body)}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"clifs/shared/units"
+)
+
+// published is the latest state for the -http server, whose handlers run
+// on their own goroutines while the UI keeps updating its model.
+var published struct {
+	sync.Mutex
+	model Model
+	at    time.Time // when model was published; zero before the first sample
+}
+
+// publish makes m's readings visible to the -http server, if it runs.
+func (m Model) publish() {
+	if *httpFlag == "" {
+		return
+	}
+	published.Lock()
+	defer published.Unlock()
+	published.model, published.at = m, time.Now()
+}
+
+// latest returns the most recently published model and when it was
+// published.
+func latest() (Model, time.Time) {
+	published.Lock()
+	defer published.Unlock()
+	return published.model, published.at
+}
+
+// metricsJSON is served at /metrics.json; unavailable readings are null.
+type metricsJSON struct {
+	Time time.Time `json:"time"`
+	sampleJSON
+	SwapUsage *float64 `json:"swap_percent"`
+	NetSent   *float64 `json:"net_sent_bytes_per_sec"`
+	NetRecv   *float64 `json:"net_recv_bytes_per_sec"`
+}
+
+func serveMetricsJSON(w http.ResponseWriter, r *http.Request) {
+	m, at := latest()
+	out := metricsJSON{Time: at}
+	if m.hasCPU {
+		out.CPUUsage = &m.cpuUsage
+	}
+	if m.memoryTotal > 0 {
+		out.MemoryUsage, out.MemoryTotal = &m.memoryUsage, &m.memoryTotal
+	}
+	if m.diskTotal > 0 {
+		out.DiskUsage, out.DiskTotal = &m.diskUsage, &m.diskTotal
+	}
+	if m.hasSwap {
+		out.SwapUsage = &m.swapUsage
+	}
+	if m.netRates != nil {
+		out.NetSent, out.NetRecv = &m.netRates[0], &m.netRates[1]
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(out)
+}
+
+// serveSummary writes the readings as text, laid out like -once.
+func serveSummary(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	m, at := latest()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if at.IsZero() {
+		fmt.Fprintln(w, "No sample taken yet")
+		return
+	}
+	cpuLine := "n/a"
+	if m.hasCPU {
+		cpuLine = fmt.Sprintf("%.1f%%", m.cpuUsage)
+	}
+	fmt.Fprintf(w, "Sampled:         %s\nCPU Usage:       %s\nMemory Usage:    %s\n%s%s\n",
+		at.Format(time.RFC1123), cpuLine, usageText(m.memoryUsage, m.memoryTotal), diskLabel(), usageText(m.diskUsage, m.diskTotal))
+	if m.netRates != nil {
+		fmt.Fprintf(w, "Network:         ↑ %s  ↓ %s\n", units.Rate(m.netRates[0]), units.Rate(m.netRates[1]))
+	}
+}
+
+// startHTTP serves the published readings on addr until the returned
+// function is called, which shuts the server down. Listening happens
+// before it returns, so a bad address is reported straight away.
+func startHTTP(addr string) (stop func(), err error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics.json", serveMetricsJSON)
+	mux.HandleFunc("/", serveSummary)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go srv.Serve(ln)
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}, nil
+}
@@ -1,58 +1,330 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 
+	"clifs/shared/notify"
+	"clifs/shared/pace"
+	"clifs/shared/rate"
+	"clifs/shared/state"
+	"clifs/shared/theme"
+	"clifs/shared/ui"
+	"clifs/shared/units"
+	"clifs/shared/version"
+
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk" // added for disk monitoring
 	"github.com/shirou/gopsutil/v3/mem"
+	psnet "github.com/shirou/gopsutil/v3/net"
+	"golang.org/x/term"
 )
 
 // Model represents the application state
 type Model struct {
-	cpuUsage    float64
-	memoryUsage float64
-	memoryTotal uint64
-	diskUsage   float64 // added for disk usage percentage
-	diskTotal   uint64  // added for disk total bytes
-	width       int
-	height      int
+	cpuUsage      float64
+	hasCPU        bool      // whether a valid CPU reading has arrived yet
+	cpuHistory    []float64 // recent CPU usage, oldest first, for the sparkline
+	memoryUsage   float64
+	memoryTotal   uint64
+	memDetail     memBreakdown
+	memHistory    []float64 // recent memory usage, oldest first, for the trend arrow
+	showMemDetail bool      // show the used/cached/buffers/available line
+	swapUsage     float64
+	swapTotal     uint64
+	hasSwap       bool                    // whether swap usage has been read, for -prom-file
+	diskUsage     float64                 // added for disk usage percentage
+	diskTotal     uint64                  // added for disk total bytes
+	diskFree      uint64                  // bytes free on the disk, for the critical banner
+	alerts        [numAlerts]notify.Alert // debounce -notify for CPU, memory and disk
+	width         int
+	height        int
+	compact       bool      // single-line layout; also used when the terminal is narrow
+	status        string    // transient message, e.g. a failed open
+	statusAt      time.Time // when status was set
+
+	diskIO        *rate.Tracker        // turns disk counters into rates
+	diskRates     map[string][]float64 // read/write bytes and operations per second, by device
+	diskPerDevice bool                 // show I/O per device rather than totals
+	diskIOPS      bool                 // show operations per second rather than throughput
+
+	showNet  bool          // show the network panel
+	showCPU  bool          // show the CPU panel
+	showMem  bool          // show the memory panel
+	showDisk bool          // show the disk usage and I/O panel
+	showSwap bool          // show the swap usage panel
+	netIO    *rate.Tracker // turns network counters into rates
+	netRates []float64     // sent/received bytes per second, all interfaces
+
+	showDisks  bool            // show the table of all mounted filesystems
+	mounts     []mountUsage    // usage of each mount, fullest first
+	diskCursor int             // highlighted row of the table
+	diskPicked map[string]bool // mounts summed into the combined row, by mount point
+
+	showProcs bool          // show the top processes
+	procs     []procInfo    // latest process list, in panel order
+	procCPU   *rate.Tracker // turns process CPU time into usage
+	procSort  procSort
+	procDesc  bool // list the processes from the largest value of procSort
+
+	pacer  *pace.Pacer // slows ticks down while usage is steady
+	active bool        // whether the latest sample moved more than the steady limits
+
+	pending      [numLoads]time.Time // when each panel's request was issued; zero once it is answered
+	mountsLoaded bool                // whether mounts has been read since the table was opened
+	spinning     bool                // whether a spinMsg is scheduled
+	spinFrame    int
+	tickGen      int           // generation of the pending tick; older ones are dropped
+	skipped      int           // ticks skipped since the last sample because it was still being taken
+	sampleTook   time.Duration // how long the last sample took beyond -cpu-sample
+	sampleSkips  int           // ticks skipped while the last sample was taken
+	refreshing   bool          // r was pressed and the new sample has not arrived yet
+}
+
+// idleAfter is how long usage must stay steady before ticks slow down.
+const idleAfter = 30 * time.Second
+
+// steadyCPU and steadyMem are the largest changes, in percentage points,
+// between ticks that still count as steady.
+const (
+	steadyCPU = 5
+	steadyMem = 1
+)
+
+// diskIOReadings returns the read and write byte counters, followed by the
+// read and write operation counters, of each physical disk, skipping
+// partitions, loop devices and RAM disks so totals are not counted twice.
+func diskIOReadings() (map[string][]uint64, error) {
+	counters, err := disk.IOCounters()
+	if err != nil {
+		return nil, err
+	}
+	readings := make(map[string][]uint64, len(counters))
+	for name, c := range counters {
+		if isVirtualDisk(name) || isPartition(name, counters) {
+			continue
+		}
+		readings[name] = []uint64{c.ReadBytes, c.WriteBytes, c.ReadCount, c.WriteCount}
+	}
+	return readings, nil
+}
+
+// isVirtualDisk reports whether name is a loop device or RAM disk.
+func isVirtualDisk(name string) bool {
+	return strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram")
+}
+
+// isPartition reports whether name is a partition of another device in
+// counters, e.g. sda1 of sda or nvme0n1p2 of nvme0n1.
+func isPartition(name string, counters map[string]disk.IOCountersStat) bool {
+	for parent := range counters {
+		if parent == name || !strings.HasPrefix(name, parent) {
+			continue
+		}
+		rest := strings.TrimPrefix(strings.TrimPrefix(name, parent), "p")
+		if rest != "" && strings.Trim(rest, "0123456789") == "" {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	themeFlag   = flag.String("theme", "", "theme name (dark, light) or path to a theme file")
+	paletteFlag = flag.String("palette", "", "colour override applied on top of the theme: colorblind")
+	versionFlag = flag.Bool("version", false, "print version information and exit")
+	onceFlag    = flag.Bool("once", false, "print a single sample and exit")
+	jsonFlag    = flag.Bool("json", false, "with -once, print the sample as JSON")
+	inlineFlag  = flag.Bool("inline", false, "draw in place below the prompt, leaving the output in the scrollback, instead of using the whole screen")
+	asciiFlag   = flag.Bool("ascii", false, "draw bars with # and - instead of coloured blocks")
+	diskFlag    = flag.String("disk", defaultDisk(), "disk or mount point to monitor")
+	panelsFlag  = flag.String("panels", "cpu,mem,disk", "comma-separated panels to show at startup: cpu, mem, disk, net, swap, procs; the last choice made with 1-6 is used when not given")
+
+	diskCriticalFlag = flag.Float64("disk-critical", 95, "disk usage percentage at which a banner warns that the -disk mount is nearly full")
+	notifyFlag       = flag.Bool("notify", false, "also show a desktop notification when CPU, memory or disk usage crosses its alert threshold")
+	cpuAlertFlag     = flag.Float64("cpu-alert", 90, "with -notify, CPU usage percentage that notifies once it lasts for "+cpuAlertFor.String())
+	memAlertFlag     = flag.Float64("mem-alert", 90, "with -notify, memory usage percentage that notifies")
+
+	httpFlag       = flag.String("http", "", "serve the latest metrics on this address, e.g. :8080, as JSON at /metrics.json and text at /")
+	promFileFlag   = flag.String("prom-file", "", "write the metrics in Prometheus text format to this file on every refresh, for node_exporter's textfile collector")
+	cpuHistoryFlag = flag.Int("cpu-history", 60, "number of CPU samples shown in the sparkline under the CPU bar")
+
+	intervalFlag = flag.Duration("interval", time.Second, "time between refreshes")
+	maxInterval  = flag.Duration("max-interval", 5*time.Second,
+		"slowest refresh, reached while usage is steady; at or below -interval disables slowing down")
+	// A non-zero -cpu-sample blocks for that long on every tick, so the
+	// effective refresh period becomes -interval plus -cpu-sample.
+	cpuSampleFlag = flag.Duration("cpu-sample", 0,
+		"measure CPU over this long each tick for smoother readings (0 = since last tick)")
+)
+
+// defaultDisk is the system drive on Windows and the root elsewhere.
+func defaultDisk() string {
+	if runtime.GOOS == "windows" {
+		return "C:"
+	}
+	return "/"
+}
+
+// diskNote explains a -disk path that was replaced by the mount holding
+// it, or by the working directory's; empty when -disk was used as given.
+var diskNote string
+
+// resolveDisk returns the mount point whose usage is shown for path: the
+// deepest mount containing it, or if path does not exist, the one
+// containing the working directory. note explains the substitution, if
+// any. It fails only when no mount can be found for either.
+func resolveDisk(path string) (mount, note string, err error) {
+	partitions, err := disk.Partitions(true)
+	if err != nil {
+		return "", "", fmt.Errorf("listing mounts: %w", err)
+	}
+	containing := func(p string) string {
+		if abs, err := filepath.Abs(p); err == nil {
+			p = abs
+		}
+		if real, err := filepath.EvalSymlinks(p); err == nil {
+			p = real
+		}
+		best := ""
+		for _, part := range partitions {
+			mp := part.Mountpoint
+			inside := strings.EqualFold(p, mp) ||
+				strings.HasPrefix(strings.ToLower(p), strings.ToLower(strings.TrimSuffix(mp, string(filepath.Separator))+string(filepath.Separator)))
+			if inside && len(mp) > len(best) {
+				best = mp
+			}
+		}
+		return best
+	}
+
+	if _, statErr := os.Stat(path); statErr == nil {
+		if mount := containing(path); mount != "" {
+			if !strings.EqualFold(filepath.Clean(path), filepath.Clean(mount)) {
+				note = fmt.Sprintf("%s is not a mount point; showing %s, which holds it", path, mount)
+			}
+			return mount, note, nil
+		}
+	}
+	if wd, err := os.Getwd(); err == nil {
+		if mount := containing(wd); mount != "" {
+			return mount, fmt.Sprintf("%s is not a disk or path here; showing %s, which holds the working directory", path, mount), nil
+		}
+	}
+	return "", "", fmt.Errorf("no mount found for %s or the working directory", path)
+}
+
+// diskLabel is the label of the disk usage line, padded to align with the
+// other metrics.
+func diskLabel() string {
+	return fmt.Sprintf("%-17s", "Disk Usage ("+*diskFlag+"):")
 }
 
 // Define some styles
 var (
+	titleStyle   lipgloss.Style
+	bannerStyle  lipgloss.Style // the disk-full banner
+	infoStyle    lipgloss.Style
+	mutedStyle   lipgloss.Style
+	risingStyle  lipgloss.Style
+	fallingStyle lipgloss.Style
+	barBaseStyle lipgloss.Style
+	cpuBarStyle  lipgloss.Style
+	cpuLineStyle lipgloss.Style // CPU sparkline
+	memBarStyle  lipgloss.Style
+	diskBarStyle lipgloss.Style
+)
+
+// Fill characters for patterned palettes and -ascii; empty draws the usual
+// solid background-coloured bar.
+var cpuFill, memFill, diskFill string
+
+// applyASCII switches the bars to plain # and - characters, for terminals
+// that draw background colours poorly and for copying into text.
+func applyASCII() {
+	barBaseStyle = lipgloss.NewStyle().PaddingLeft(1).PaddingRight(1)
+	cpuBarStyle, memBarStyle, diskBarStyle = lipgloss.NewStyle(), lipgloss.NewStyle(), lipgloss.NewStyle()
+	cpuLineStyle = lipgloss.NewStyle()
+	cpuFill, memFill, diskFill = "#", "#", "#"
+	ui.BarBase, ui.EmptyChar = barBaseStyle, "-"
+}
+
+// applyTheme builds the styles from the palette.
+func applyTheme(p theme.Palette) {
 	titleStyle = lipgloss.NewStyle().
-			Bold(true).
-			Foreground(lipgloss.Color("#FAFAFA")).
-			Background(lipgloss.Color("#7D56F4")).
-			PaddingLeft(2).
-			PaddingRight(2)
+		Bold(true).
+		Foreground(lipgloss.Color(p.Text)).
+		Background(lipgloss.Color(p.Title)).
+		PaddingLeft(2).
+		PaddingRight(2)
+
+	bannerStyle = lipgloss.NewStyle().
+		Bold(true).
+		Foreground(lipgloss.Color(p.Text)).
+		Background(lipgloss.Color(p.Error)).
+		PaddingLeft(1)
 
 	infoStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#FAFAFA")).
-			Italic(true)
+		Foreground(lipgloss.Color(p.Text)).
+		Italic(true)
+
+	mutedStyle = lipgloss.NewStyle().
+		Foreground(lipgloss.Color(p.Muted))
+
+	risingStyle = lipgloss.NewStyle().
+		Foreground(lipgloss.Color(p.Error))
+
+	fallingStyle = lipgloss.NewStyle().
+		Foreground(lipgloss.Color(p.Success))
 
 	barBaseStyle = lipgloss.NewStyle().
-			Background(lipgloss.Color("#333333")).
-			PaddingLeft(1).
-			PaddingRight(1)
+		Background(lipgloss.Color(p.BarBase)).
+		PaddingLeft(1).
+		PaddingRight(1)
 
 	cpuBarStyle = lipgloss.NewStyle().
-			Background(lipgloss.Color("#FF4757"))
+		Background(lipgloss.Color(p.CPU))
+
+	cpuLineStyle = lipgloss.NewStyle().
+		Foreground(lipgloss.Color(p.CPU))
 
 	memBarStyle = lipgloss.NewStyle().
-			Background(lipgloss.Color("#2ED573"))
+		Background(lipgloss.Color(p.Mem))
 
-	diskBarStyle = lipgloss.NewStyle(). // new style for disk usage bar
-			Background(lipgloss.Color("#1E90FF"))
-)
+	diskBarStyle = lipgloss.NewStyle().
+		Background(lipgloss.Color(p.Disk))
+
+	cpuFill, memFill, diskFill = "", "", ""
+	if p.Patterned {
+		// Draw the fill as coloured characters so each bar has its own
+		// texture as well as its own colour.
+		cpuBarStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(p.CPU))
+		memBarStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(p.Mem))
+		diskBarStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(p.Disk))
+		cpuFill, memFill, diskFill = "█", "▓", "▒"
+	}
+	ui.BarBase = barBaseStyle
+}
 
 // Init initializes the model
 func (m Model) Init() tea.Cmd {
-	return tick()
+	// cpu.Percent with a zero interval measures since the previous call, so
+	// prime it now to make the first tick's reading meaningful.
+	cpu.Percent(0, false)
+	return tick(m.tickGen, m.pacer.Interval())
 }
 
 // Update updates the model based on messages
@@ -64,43 +336,538 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case tea.KeyMsg:
+		// Any key returns to fast refreshes straight away.
+		var cmd tea.Cmd
+		if m.pacer.Interval() > m.pacer.Min {
+			m.pacer.Reset(time.Now())
+			m.tickGen++
+			cmd = tick(m.tickGen, m.pacer.Interval())
+		}
 		switch msg.String() {
 		case "q", "ctrl+c":
 			return m, tea.Quit
+		case "d":
+			m.diskPerDevice = !m.diskPerDevice
+		case "i":
+			m.diskIOPS = !m.diskIOPS
+		case "t":
+			m.showDisks = !m.showDisks
+			if m.showDisks {
+				m.mountsLoaded = false
+				var cmds []tea.Cmd
+				m, cmds = m.load(loadMounts, []tea.Cmd{cmd}, fetchMounts)
+				cmd = tea.Batch(cmds...)
+			}
+		case "down", "j":
+			if m.showDisks {
+				m.diskCursor = min(m.diskCursor+1, max(len(m.mounts)-1, 0))
+			}
+		case "up", "k":
+			if m.showDisks {
+				m.diskCursor = max(m.diskCursor-1, 0)
+			}
+		case "enter":
+			if m.showDisks && m.diskCursor < len(m.mounts) {
+				if m.diskPicked == nil {
+					m.diskPicked = make(map[string]bool)
+				}
+				mount := m.mounts[m.diskCursor].Mountpoint
+				if m.diskPicked[mount] {
+					delete(m.diskPicked, mount)
+				} else {
+					m.diskPicked[mount] = true
+				}
+			}
+		case "6", "p":
+			m.showProcs = !m.showProcs
+			if m.showProcs {
+				var cmds []tea.Cmd
+				m, cmds = m.load(loadProcs, []tea.Cmd{cmd}, readProcs)
+				cmd = tea.Batch(cmds...)
+			} else {
+				m.procs, m.procCPU = nil, nil
+			}
+			savePanels(m)
+		case "s":
+			if m.showProcs {
+				m.procSort = (m.procSort + 1) % numSorts
+				m.procDesc = m.procSort.descending()
+				m.sortProcs()
+			}
+		case "S":
+			if m.showProcs {
+				m.procDesc = !m.procDesc
+				m.sortProcs()
+			}
+		case "o":
+			return m, openInFileBrowser(*diskFlag)
+		case "c":
+			m.compact = !m.compact
+		case "m":
+			m.showMemDetail = !m.showMemDetail
+		case "1":
+			m.showCPU = !m.showCPU
+			savePanels(m)
+		case "2":
+			m.showMem = !m.showMem
+			savePanels(m)
+		case "3":
+			m.showDisk = !m.showDisk
+			savePanels(m)
+		case "4", "n":
+			m.showNet = !m.showNet
+			m.netIO, m.netRates = nil, nil
+			savePanels(m)
+		case "5":
+			m.showSwap = !m.showSwap
+			savePanels(m)
+		case "r", " ":
+			// Restart the tick too, so the refresh does not stack with
+			// one that is about to fire.
+			m.tickGen++
+			m.refreshing = true
+			var cmds []tea.Cmd
+			m, cmds = m.fetch([]tea.Cmd{tick(m.tickGen, m.pacer.Interval())})
+			cmd = tea.Batch(cmds...)
+		case "+", "=":
+			m.pacer.Faster(time.Now())
+			m.tickGen++
+			cmd = tick(m.tickGen, m.pacer.Interval())
+		case "-":
+			m.pacer.Slower(time.Now())
+			m.tickGen++
+			cmd = tick(m.tickGen, m.pacer.Interval())
+		}
+		return m, cmd
+
+	case openResultMsg:
+		if msg.err != nil {
+			m.status = fmt.Sprintf("Could not open %s: %v", *diskFlag, msg.err)
+			m.statusAt = time.Now()
 		}
+		return m, nil
 
 	case tickMsg:
-		// Get CPU usage
-		cpuPercentages, err := cpu.Percent(0, false)
-		if err == nil && len(cpuPercentages) > 0 {
-			m.cpuUsage = cpuPercentages[0]
+		if msg.gen != m.tickGen {
+			return m, nil // superseded by a key press
 		}
+		var cmds []tea.Cmd
+		m, cmds = m.fetch([]tea.Cmd{tick(m.tickGen, m.pacer.Observe(msg.at, m.active))})
+		return m, tea.Batch(cmds...)
 
-		// Get memory usage
-		memInfo, err := mem.VirtualMemory()
-		if err == nil {
-			m.memoryUsage = memInfo.UsedPercent
-			m.memoryTotal = memInfo.Total
+	case sampleMsg:
+		// Rates use the real time between readings, so a slow sample
+		// only delays them; it is still worth pointing out.
+		m.sampleTook = max(time.Since(m.pending[loadSample])-*cpuSampleFlag, 0)
+		m.sampleSkips, m.skipped = m.skipped, 0
+		m.pending[loadSample] = time.Time{}
+		m.refreshing = false
+		sample := msg.sample
+		m.active = sample.hasCPU && math.Abs(sample.CPUUsage-m.cpuUsage) > steadyCPU ||
+			sample.hasMem && math.Abs(sample.MemoryUsage-m.memoryUsage) > steadyMem
+		if sample.hasCPU {
+			m.cpuUsage = sample.CPUUsage
+			m.hasCPU = true
+			m.cpuHistory = append(m.cpuHistory, sample.CPUUsage)
+			if len(m.cpuHistory) > *cpuHistoryFlag {
+				m.cpuHistory = m.cpuHistory[len(m.cpuHistory)-*cpuHistoryFlag:]
+			}
 		}
+		if sample.hasMem {
+			m.memHistory = append(m.memHistory, sample.MemoryUsage)
+			if len(m.memHistory) > memTrendLen {
+				m.memHistory = m.memHistory[len(m.memHistory)-memTrendLen:]
+			}
+			m.memoryUsage = sample.MemoryUsage
+			m.memoryTotal = sample.MemoryTotal
+			m.memDetail = sample.MemoryDetail
+		}
+		if sample.hasDisk {
+			m.diskUsage = sample.DiskUsage
+			m.diskTotal = sample.DiskTotal
+			m.diskFree = sample.DiskFree
+		}
+		if sample.hasSwap {
+			m.swapUsage, m.swapTotal, m.hasSwap = sample.SwapUsage, sample.SwapTotal, true
+		}
+		m.publish()
+		return m, tea.Batch(m.exportProm(), m.checkAlerts(msg.at))
 
-		// Disk usage update (using "C:" drive)
-		diskInfo, err := disk.Usage("C:")
-		if err == nil {
-			m.diskUsage = diskInfo.UsedPercent
-			m.diskTotal = diskInfo.Total
+	case notifiedMsg:
+		if msg.err != nil {
+			m.status = fmt.Sprintf("Could not show a notification: %v", msg.err)
+			m.statusAt = time.Now()
 		}
+		return m, nil
 
-		return m, tick()
+	case promWrittenMsg:
+		if msg.err != nil {
+			m.status = fmt.Sprintf("Could not write %s: %v", *promFileFlag, msg.err)
+			m.statusAt = time.Now()
+		}
+		return m, nil
+
+	case diskIOMsg:
+		m.pending[loadDiskIO] = time.Time{}
+		if msg.err == nil {
+			if m.diskIO == nil {
+				m.diskIO = &rate.Tracker{}
+			}
+			if rates := m.diskIO.Update(msg.at, msg.readings); len(rates) > 0 {
+				m.diskRates = rates
+			}
+		}
+		m.publish()
+		return m, nil
+
+	case mountsMsg:
+		m.pending[loadMounts] = time.Time{}
+		m.mounts = msg
+		m.mountsLoaded = true
+		m.diskCursor = min(m.diskCursor, max(len(m.mounts)-1, 0))
+		return m, nil
+
+	case procsMsg:
+		m.pending[loadProcs] = time.Time{}
+		if m.showProcs && msg.err == nil {
+			m.setProcs(msg)
+		}
+		return m, nil
+
+	case netMsg:
+		m.pending[loadNet] = time.Time{}
+		// Drop results that arrive after the panel was hidden, unless
+		// they are exported.
+		if m.wantNet() && msg.err == nil && len(msg.counters) > 0 {
+			if m.netIO == nil {
+				m.netIO = &rate.Tracker{}
+			}
+			readings := map[string][]uint64{"all": {msg.counters[0].BytesSent, msg.counters[0].BytesRecv}}
+			if rates, ok := m.netIO.Update(msg.at, readings)["all"]; ok {
+				m.netRates = rates
+			}
+		}
+		m.publish()
+		return m, nil
+
+	case spinMsg:
+		m.spinFrame++
+		if m.loading() {
+			return m, spin()
+		}
+		m.spinning = false
+		return m, nil
 	}
 
 	return m, nil
 }
 
+// Panels whose data is gathered in the background, indexing
+// Model.pending.
+const (
+	loadSample = iota // CPU, memory and disk usage
+	loadDiskIO
+	loadMounts
+	loadNet
+	loadProcs
+	numLoads
+)
+
+// slowAfter is how long a request may be out before its panel shows a
+// spinner; quicker ones would only flicker.
+const slowAfter = 300 * time.Millisecond
+
+var spinFrames = []rune("⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏")
+
+// spinMsg advances the loading spinner.
+type spinMsg struct{}
+
+func spin() tea.Cmd {
+	return tea.Tick(100*time.Millisecond, func(time.Time) tea.Msg { return spinMsg{} })
+}
+
+// Results of the background requests.
+type (
+	sampleMsg struct {
+		at     time.Time
+		sample sample
+	}
+	diskIOMsg struct {
+		at       time.Time
+		readings map[string][]uint64
+		err      error
+	}
+	mountsMsg []mountUsage
+	netMsg    struct {
+		at       time.Time
+		counters []psnet.IOCountersStat
+		err      error
+	}
+)
+
+func fetchMounts() tea.Msg { return mountsMsg(readMounts()) }
+
+// fetch requests fresh readings for the visible panels, appending the
+// commands to cmds. Gathering runs in commands so a slow call never blocks
+// input, and a panel whose previous request is still out is not asked
+// again.
+func (m Model) fetch(cmds []tea.Cmd) (Model, []tea.Cmd) {
+	m, cmds = m.load(loadSample, cmds, func() tea.Msg {
+		return sampleMsg{at: time.Now(), sample: takeSample(*cpuSampleFlag)}
+	})
+	m, cmds = m.load(loadDiskIO, cmds, func() tea.Msg {
+		readings, err := diskIOReadings()
+		return diskIOMsg{at: time.Now(), readings: readings, err: err}
+	})
+	if m.showDisks {
+		m, cmds = m.load(loadMounts, cmds, fetchMounts)
+	}
+	if m.showProcs {
+		m, cmds = m.load(loadProcs, cmds, readProcs)
+	}
+	if m.wantNet() {
+		m, cmds = m.load(loadNet, cmds, func() tea.Msg {
+			counters, err := psnet.IOCounters(false)
+			return netMsg{at: time.Now(), counters: counters, err: err}
+		})
+	}
+	return m, cmds
+}
+
+// wantNet reports whether network rates are needed, for the panel or for
+// export.
+func (m Model) wantNet() bool {
+	return m.showNet || *promFileFlag != "" || *httpFlag != ""
+}
+
+// load issues cmd for the panel unless its previous request is still out,
+// starting the spinner if it is not already running.
+func (m Model) load(panel int, cmds []tea.Cmd, cmd tea.Cmd) (Model, []tea.Cmd) {
+	if !m.pending[panel].IsZero() {
+		if panel == loadSample {
+			m.skipped++
+		}
+		return m, cmds
+	}
+	m.pending[panel] = time.Now()
+	cmds = append(cmds, cmd)
+	if !m.spinning {
+		m.spinning = true
+		cmds = append(cmds, spin())
+	}
+	return m, cmds
+}
+
+// loading reports whether any request is still out.
+func (m Model) loading() bool {
+	for _, since := range m.pending {
+		if !since.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// spinner is a spinner frame, preceded by a space, while the panel's
+// request has been out for longer than slowAfter, and otherwise empty.
+func (m Model) spinner(panel int) string {
+	since := m.pending[panel]
+	if since.IsZero() || time.Since(since) < slowAfter {
+		return ""
+	}
+	return " " + mutedStyle.Render(string(spinFrames[m.spinFrame%len(spinFrames)]))
+}
+
+// sample is a single reading of every metric. The has* fields record
+// which readings succeeded.
+type sample struct {
+	CPUUsage     float64
+	MemoryUsage  float64
+	MemoryTotal  uint64
+	MemoryDetail memBreakdown
+	DiskUsage    float64
+	DiskTotal    uint64
+	DiskFree     uint64
+	SwapUsage    float64
+	SwapTotal    uint64
+
+	hasCPU, hasMem, hasDisk, hasSwap bool
+}
+
+// memBreakdown splits memory use into its parts, in bytes.
+type memBreakdown struct {
+	Used      uint64
+	Cached    uint64
+	Buffers   uint64
+	Available uint64
+}
+
+// String lists the parts of the breakdown. Parts the platform does not
+// report, such as cached and buffers on Windows, are zero and left out.
+func (b memBreakdown) String() string {
+	var parts []string
+	for _, p := range []struct {
+		name  string
+		value uint64
+	}{
+		{"used", b.Used},
+		{"cached", b.Cached},
+		{"buffers", b.Buffers},
+		{"available", b.Available},
+	} {
+		if p.value > 0 {
+			parts = append(parts, p.name+" "+units.Bytes(float64(p.value)))
+		}
+	}
+	return strings.Join(parts, "  ")
+}
+
+// sampleJSON is the -json form of a sample; unavailable readings are null.
+type sampleJSON struct {
+	CPUUsage    *float64 `json:"cpu_percent"`
+	MemoryUsage *float64 `json:"memory_percent"`
+	MemoryTotal *uint64  `json:"memory_total_bytes"`
+	DiskUsage   *float64 `json:"disk_percent"`
+	DiskTotal   *uint64  `json:"disk_total_bytes"`
+}
+
+// takeSample reads all metrics. cpuInterval is passed to cpu.Percent; zero
+// measures since the previous call.
+func takeSample(cpuInterval time.Duration) sample {
+	var s sample
+
+	// Get CPU usage
+	cpuPercentages, err := cpu.Percent(cpuInterval, false)
+	if err == nil && len(cpuPercentages) > 0 {
+		s.CPUUsage = cpuPercentages[0]
+		s.hasCPU = true
+	}
+
+	// Get memory usage
+	memInfo, err := mem.VirtualMemory()
+	if err == nil && memInfo.Total > 0 {
+		s.MemoryUsage = memInfo.UsedPercent
+		s.MemoryTotal = memInfo.Total
+		s.MemoryDetail = memBreakdown{
+			Used:      memInfo.Used,
+			Cached:    memInfo.Cached,
+			Buffers:   memInfo.Buffers,
+			Available: memInfo.Available,
+		}
+		s.hasMem = true
+	}
+
+	swapInfo, err := mem.SwapMemory()
+	if err == nil {
+		s.SwapUsage = swapInfo.UsedPercent
+		s.SwapTotal = swapInfo.Total
+		s.hasSwap = true
+	}
+
+	// Disk usage update (using the -disk path)
+	diskInfo, err := disk.Usage(*diskFlag)
+	if err == nil && diskInfo.Total > 0 {
+		s.DiskUsage = diskInfo.UsedPercent
+		s.DiskTotal = diskInfo.Total
+		s.DiskFree = diskInfo.Free
+		s.hasDisk = true
+	}
+
+	return s
+}
+
+// printOnce samples once and prints the result as text or JSON.
+func printOnce(asJSON bool) error {
+	interval := 200 * time.Millisecond
+	if *cpuSampleFlag > 0 {
+		interval = *cpuSampleFlag
+	}
+	s := takeSample(interval)
+	if asJSON {
+		var out sampleJSON
+		if s.hasCPU {
+			out.CPUUsage = &s.CPUUsage
+		}
+		if s.hasMem {
+			out.MemoryUsage, out.MemoryTotal = &s.MemoryUsage, &s.MemoryTotal
+		}
+		if s.hasDisk {
+			out.DiskUsage, out.DiskTotal = &s.DiskUsage, &s.DiskTotal
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+
+	cpuLine := "n/a"
+	if s.hasCPU {
+		cpuLine = fmt.Sprintf("%.1f%%", s.CPUUsage)
+	}
+	memLine := usageText(s.MemoryUsage, s.MemoryTotal)
+	diskLine := usageText(s.DiskUsage, s.DiskTotal)
+	_, err := fmt.Printf("CPU Usage:       %s\nMemory Usage:    %s\n%s%s\n", cpuLine, memLine, diskLabel(), diskLine)
+	return err
+}
+
+// memTrendLen is the number of memory samples the trend is fitted to.
+const memTrendLen = 10
+
+// memTrendFlat is the slope, in percentage points per sample, below which
+// memory usage counts as flat.
+const memTrendFlat = 0.05
+
+// slope is the gradient of the least-squares line through values, taken
+// at equal steps.
+func slope(values []float64) float64 {
+	n := float64(len(values))
+	if n < 2 {
+		return 0
+	}
+	var sumX, sumY, sumXY, sumXX float64
+	for i, y := range values {
+		x := float64(i)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	return (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+}
+
+// memTrend is an arrow showing whether memory usage is rising, falling or
+// flat over the recent samples; red when rising.
+func (m Model) memTrend() string {
+	if len(m.memHistory) < 3 {
+		return " "
+	}
+	switch k := slope(m.memHistory); {
+	case k > memTrendFlat:
+		return risingStyle.Render("↑")
+	case k < -memTrendFlat:
+		return fallingStyle.Render("↓")
+	default:
+		return mutedStyle.Render("→")
+	}
+}
+
+// usageText formats a usage percentage with used and total gigabytes, or
+// "n/a" when total is zero because the reading is missing.
+func usageText(percent float64, total uint64) string {
+	if total == 0 {
+		return "n/a"
+	}
+	totalGB := float64(total) / 1024 / 1024 / 1024
+	return fmt.Sprintf("%.1f%% (%.1f/%.1f GB)", percent, totalGB*percent/100, totalGB)
+}
+
 // View renders the UI
 func (m Model) View() string {
 	if m.width == 0 {
 		return "Initializing..."
 	}
+	if m.compact || m.width < compactWidth {
+		return m.compactView()
+	}
 
 	// Calculate bar width (max 50 chars or screen width - 20)
 	maxBarWidth := m.width - 20
@@ -111,67 +878,473 @@ func (m Model) View() string {
 		maxBarWidth = 10
 	}
 
-	// Render CPU usage bar
-	cpuBarWidth := int((m.cpuUsage / 100) * float64(maxBarWidth))
-	cpuBar := barBaseStyle.Render(
-		cpuBarStyle.Width(cpuBarWidth).Render("") +
-			lipgloss.NewStyle().Width(maxBarWidth-cpuBarWidth).Render(""),
-	)
-
-	// Render Memory usage bar
-	memBarWidth := int((m.memoryUsage / 100) * float64(maxBarWidth))
-	memBar := barBaseStyle.Render(
-		memBarStyle.Width(memBarWidth).Render("") +
-			lipgloss.NewStyle().Width(maxBarWidth-memBarWidth).Render(""),
-	)
-
-	// Render Disk usage bar
-	diskBarWidth := int((m.diskUsage / 100) * float64(maxBarWidth))
-	diskBar := barBaseStyle.Render(
-		diskBarStyle.Width(diskBarWidth).Render("") +
-			lipgloss.NewStyle().Width(maxBarWidth-diskBarWidth).Render(""),
-	)
-
-	// Calculate memory usage in GB
-	memUsedGB := float64(m.memoryTotal) * m.memoryUsage / 100 / 1024 / 1024 / 1024
-	memTotalGB := float64(m.memoryTotal) / 1024 / 1024 / 1024
-
-	// Calculate disk usage in GB
-	diskUsedGB := float64(m.diskTotal) * m.diskUsage / 100 / 1024 / 1024 / 1024
-	diskTotalGB := float64(m.diskTotal) / 1024 / 1024 / 1024
-
-	return fmt.Sprintf(
-		"\n %s\n\n CPU Usage:       %s %.1f%%\n\n Memory Usage:    %s %.1f%% (%.1f/%.1f GB)\n\n Disk Usage (C:): %s %.1f%% (%.1f/%.1f GB)\n\n %s\n\n",
-		titleStyle.Render(" SYSTEM MONITOR "),
-		cpuBar,
-		m.cpuUsage,
-		memBar,
-		m.memoryUsage,
-		memUsedGB,
-		memTotalGB,
-		diskBar,
-		m.diskUsage,
-		diskUsedGB,
-		diskTotalGB,
-		infoStyle.Render("Press q to quit"),
-	)
+	cpuLine := ui.PatternBar(m.cpuUsage, 100, maxBarWidth, cpuBarStyle, cpuFill) + fmt.Sprintf(" %.1f%%", m.cpuUsage)
+	if !m.hasCPU {
+		cpuLine = mutedStyle.Render("measuring...")
+	}
+	if len(m.cpuHistory) > 1 {
+		// The bar's padding cells are part of its width, so the sparkline
+		// takes them too to line up with it.
+		cpuLine += "\n                  " + cpuLineStyle.Render(ui.SparklineScaled(m.cpuHistory, maxBarWidth+2, 100))
+	}
+	memBar := ui.PatternBar(m.memoryUsage, 100, maxBarWidth, memBarStyle, memFill)
+	diskBar := ui.PatternBar(m.diskUsage, 100, maxBarWidth, diskBarStyle, diskFill)
+
+	s := m.diskBannerView() + "\n " + titleStyle.Render(" SYSTEM MONITOR ") + "\n\n"
+	if m.showCPU {
+		s += " CPU Usage:       " + cpuLine + m.spinner(loadSample) + "\n\n"
+	}
+	if m.showMem {
+		s += fmt.Sprintf(" Memory Usage:    %s %s %s%s\n%s\n",
+			memBar, usageText(m.memoryUsage, m.memoryTotal), m.memTrend(), m.spinner(loadSample), m.memDetailView())
+	}
+	if m.showSwap {
+		s += fmt.Sprintf(" Swap Usage:      %s %s%s\n\n",
+			ui.PatternBar(m.swapUsage, 100, maxBarWidth, memBarStyle, memFill), usageText(m.swapUsage, m.swapTotal), m.spinner(loadSample))
+	}
+	if m.showDisk {
+		s += fmt.Sprintf(" %s%s %s%s\n", diskLabel(), diskBar, usageText(m.diskUsage, m.diskTotal), m.spinner(loadSample))
+		if diskNote != "" {
+			s += "                  " + mutedStyle.Render(diskNote) + "\n"
+		}
+		s += "\n" + m.diskIOView()
+	}
+	s += m.disksView(maxBarWidth) + m.procsView() + m.netView() + m.lagView() + m.statusView()
+	return s + " " + infoStyle.Render("Press q to quit, c for compact, 1-6 (or n, p) to show/hide CPU, memory, disk, network, swap and processes, m for memory detail, d for per-device disk I/O, i for IOPS, t for all disks, o to open disk, r to refresh now, +/- to change speed") +
+		mutedStyle.Render(fmt.Sprintf("  · every %s%s", m.pacer.Interval(), m.refreshingNote())) + "\n\n"
+}
+
+// panelNames lists the panels that -panels and the 1-6 keys show and hide,
+// in key order.
+var panelNames = []string{"cpu", "mem", "disk", "net", "swap", "procs"}
+
+// panelsStateName is the state file the visible panels are saved to.
+const panelsStateName = "sys-monitor-panels"
+
+// savedPanels is the on-disk form of the visible panels.
+type savedPanels struct {
+	Panels []string `json:"panels"`
+}
+
+// parsePanels turns a comma-separated list of panel names into the set of
+// visible panels.
+func parsePanels(list string) (map[string]bool, error) {
+	visible := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(strings.ToLower(name))
+		if name == "" {
+			continue
+		}
+		if !slices.Contains(panelNames, name) {
+			return nil, fmt.Errorf("unknown panel %q (want %s)", name, strings.Join(panelNames, ", "))
+		}
+		visible[name] = true
+	}
+	return visible, nil
+}
+
+// setPanels shows exactly the panels in visible.
+func (m *Model) setPanels(visible map[string]bool) {
+	m.showCPU, m.showMem, m.showDisk, m.showNet = visible["cpu"], visible["mem"], visible["disk"], visible["net"]
+	m.showSwap, m.showProcs = visible["swap"], visible["procs"]
+}
+
+// savePanels records the visible panels so the next run starts with them.
+// Failing to save only loses the preference, so errors are ignored.
+func savePanels(m Model) {
+	var saved savedPanels
+	for i, on := range []bool{m.showCPU, m.showMem, m.showDisk, m.showNet, m.showSwap, m.showProcs} {
+		if on {
+			saved.Panels = append(saved.Panels, panelNames[i])
+		}
+	}
+	state.Save(panelsStateName, saved)
+}
+
+// statusDuration is how long a transient status stays on screen.
+const statusDuration = 5 * time.Second
+
+// refreshingNote marks a refresh asked for with r until it lands.
+func (m Model) refreshingNote() string {
+	if m.refreshing {
+		return " · refreshing..."
+	}
+	return ""
+}
+
+// lagView warns when taking a sample took longer than the refresh
+// interval, so readings arrive late and ticks were skipped.
+func (m Model) lagView() string {
+	if m.sampleTook <= m.pacer.Interval() {
+		return ""
+	}
+	line := fmt.Sprintf("⚠ Sampling lag: the last sample took %s, longer than the %s interval", m.sampleTook.Round(100*time.Millisecond), m.pacer.Interval())
+	if m.sampleSkips > 0 {
+		line += fmt.Sprintf("; %d ticks skipped", m.sampleSkips)
+	}
+	return " " + risingStyle.Render(line) + "\n\n"
+}
+
+// statusView renders the transient status line, if any.
+func (m Model) statusView() string {
+	if m.status == "" || time.Since(m.statusAt) > statusDuration {
+		return ""
+	}
+	return " " + infoStyle.Render(m.status) + "\n\n"
+}
+
+// openResultMsg reports the outcome of opening the file browser.
+type openResultMsg struct {
+	err error
+}
+
+// openTimeout bounds how long the file browser launcher may run.
+const openTimeout = 10 * time.Second
+
+// openInFileBrowser opens path in the platform's file browser.
+func openInFileBrowser(path string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), openTimeout)
+		defer cancel()
+
+		var cmd *exec.Cmd
+		switch runtime.GOOS {
+		case "windows":
+			// explorer needs a trailing separator to open a bare drive.
+			if !strings.HasSuffix(path, `\`) {
+				path += `\`
+			}
+			cmd = exec.CommandContext(ctx, "explorer", path)
+		case "darwin":
+			cmd = exec.CommandContext(ctx, "open", path)
+		default:
+			cmd = exec.CommandContext(ctx, "xdg-open", path)
+		}
+		err := cmd.Run()
+		// explorer exits non-zero even when it succeeds.
+		if _, ok := err.(*exec.ExitError); ok && runtime.GOOS == "windows" {
+			err = nil
+		}
+		return openResultMsg{err: err}
+	}
+}
+
+// compactWidth is the terminal width below which the compact layout is
+// used automatically.
+const compactWidth = 60
+
+// compactView renders all metrics on one line with mini bars, for narrow
+// terminals.
+func (m Model) compactView() string {
+	// Three metrics, each with a label, percentage and two padding cells.
+	miniWidth := (m.width - 39) / 3
+	if miniWidth > 10 {
+		miniWidth = 10
+	}
+	if miniWidth < 3 {
+		miniWidth = 3
+	}
+	mini := func(percent float64, style lipgloss.Style, fill string) string {
+		return ui.PatternBar(percent, 100, miniWidth, style, fill)
+	}
+	percent := func(p float64, total uint64) string {
+		if total == 0 {
+			return " n/a"
+		}
+		return fmt.Sprintf("%3.0f%%", p)
+	}
+	cpuPercent := fmt.Sprintf("%3.0f%%", m.cpuUsage)
+	if !m.hasCPU {
+		cpuPercent = " ..."
+	}
+	var parts []string
+	if m.showCPU {
+		parts = append(parts, fmt.Sprintf("CPU %s %s ", mini(m.cpuUsage, cpuBarStyle, cpuFill), cpuPercent))
+	}
+	if m.showMem {
+		parts = append(parts, fmt.Sprintf("MEM %s %s%s", mini(m.memoryUsage, memBarStyle, memFill), percent(m.memoryUsage, m.memoryTotal), m.memTrend()))
+	}
+	if m.showDisk {
+		parts = append(parts, fmt.Sprintf("DISK %s %s", mini(m.diskUsage, diskBarStyle, diskFill), percent(m.diskUsage, m.diskTotal)))
+	}
+	return m.diskBannerView() + fmt.Sprintf("\n %s\n %s\n", strings.Join(parts, " "), infoStyle.Render("q quit, c full view"))
+}
+
+// diskBannerView renders a full-width warning while the -disk mount is at
+// or above -disk-critical, whether or not the disk panel is shown, since a
+// full disk breaks things. It clears once usage drops below the threshold.
+func (m Model) diskBannerView() string {
+	if m.diskTotal == 0 || m.diskUsage < *diskCriticalFlag {
+		return ""
+	}
+	text := fmt.Sprintf("⚠ DISK NEARLY FULL: %s is %.1f%% used, %s free", *diskFlag, m.diskUsage, units.Bytes(float64(m.diskFree)))
+	return bannerStyle.Width(m.width).Render(text) + "\n"
+}
+
+// memDetailView renders the memory breakdown line when enabled.
+func (m Model) memDetailView() string {
+	if !m.showMemDetail {
+		return ""
+	}
+	return "                  " + infoStyle.Render(m.memDetail.String()) + "\n"
+}
+
+// netView renders total network throughput when the panel is enabled.
+func (m Model) netView() string {
+	if !m.showNet {
+		return ""
+	}
+	if m.netRates == nil {
+		return " Network:         ↑ --  ↓ --" + m.spinner(loadNet) + "\n\n"
+	}
+	return fmt.Sprintf(" Network:         ↑ %s  ↓ %s%s\n\n", units.Rate(m.netRates[0]), units.Rate(m.netRates[1]), m.spinner(loadNet))
+}
+
+// diskIOView renders disk throughput, or operations per second when
+// toggled, totalled or per device. Rates show "--" until two samples have
+// been taken.
+func (m Model) diskIOView() string {
+	label, format, first := " Disk I/O:       ", units.Rate, 0
+	if m.diskIOPS {
+		label, format, first = " Disk IOPS:      ", iops, 2
+	}
+	if m.diskRates == nil {
+		return label + " R --  W --" + m.spinner(loadDiskIO) + "\n\n"
+	}
+
+	names := make([]string, 0, len(m.diskRates))
+	var read, write float64
+	for name, r := range m.diskRates {
+		names = append(names, name)
+		read += r[first]
+		write += r[first+1]
+	}
+	s := fmt.Sprintf("%s R %s  W %s%s\n", label, format(read), format(write), m.spinner(loadDiskIO))
+	if m.diskPerDevice {
+		sort.Strings(names)
+		for _, name := range names {
+			r := m.diskRates[name]
+			s += fmt.Sprintf("   %-14s R %s  W %s\n", name, format(r[first]), format(r[first+1]))
+		}
+	}
+	return s + "\n"
+}
+
+// iops formats a number of operations per second.
+func iops(perSec float64) string {
+	return fmt.Sprintf("%.0f/s", perSec)
+}
+
+// mountUsage is the usage of one mounted filesystem.
+type mountUsage struct {
+	Mountpoint string
+	Fstype     string
+	Used       uint64
+	Total      uint64
+	Percent    float64
+}
+
+// readMounts returns the usage of each physical filesystem, fullest first.
+// Filesystems that cannot be read, or report no size, are left out.
+func readMounts() []mountUsage {
+	partitions, err := disk.Partitions(false)
+	if err != nil {
+		return nil
+	}
+	seen := make(map[string]bool, len(partitions))
+	var mounts []mountUsage
+	for _, p := range partitions {
+		if seen[p.Mountpoint] {
+			continue
+		}
+		seen[p.Mountpoint] = true
+		u, err := disk.Usage(p.Mountpoint)
+		if err != nil || u.Total == 0 {
+			continue
+		}
+		mounts = append(mounts, mountUsage{
+			Mountpoint: p.Mountpoint,
+			Fstype:     p.Fstype,
+			Used:       u.Used,
+			Total:      u.Total,
+			Percent:    u.UsedPercent,
+		})
+	}
+	sort.Slice(mounts, func(i, j int) bool { return mounts[i].Percent > mounts[j].Percent })
+	return mounts
+}
+
+// disksView renders the table of mounted filesystems when enabled. The
+// highlighted row is marked with >, and the mounts picked with Enter with
+// *; their combined usage is drawn as a bar barWidth cells wide below the
+// table.
+func (m Model) disksView(barWidth int) string {
+	if !m.showDisks {
+		return ""
+	}
+	if !m.mountsLoaded {
+		return " Disks:           loading" + m.spinner(loadMounts) + "\n\n"
+	}
+	if len(m.mounts) == 0 {
+		return " Disks:           none found\n\n"
+	}
+
+	mountWidth := len("Mount")
+	for _, mu := range m.mounts {
+		mountWidth = max(mountWidth, len(mu.Mountpoint))
+	}
+	mountCol := lipgloss.NewStyle().Width(mountWidth + 2)
+	typeCol := lipgloss.NewStyle().Width(10)
+	numCol := lipgloss.NewStyle().Width(8).Align(lipgloss.Right)
+	sizeCol := lipgloss.NewStyle().Width(22).Align(lipgloss.Right)
+
+	row := func(marks, mount, fstype, percent, size string) string {
+		return marks + " " + lipgloss.JoinHorizontal(lipgloss.Top,
+			mountCol.Render(mount), typeCol.Render(fstype), numCol.Render(percent), sizeCol.Render(size))
+	}
+	s := " Disks:" + m.spinner(loadMounts) + "\n" + infoStyle.Render(row("  ", "Mount", "Type", "Used", "Used / Total")) + "\n"
+	var used, total uint64
+	picked := 0
+	for i, mu := range m.mounts {
+		marks := []byte("  ")
+		if i == m.diskCursor {
+			marks[0] = '>'
+		}
+		if m.diskPicked[mu.Mountpoint] {
+			marks[1] = '*'
+			used += mu.Used
+			total += mu.Total
+			picked++
+		}
+		s += row(string(marks), mu.Mountpoint, mu.Fstype, fmt.Sprintf("%.1f%%", mu.Percent),
+			units.Bytes(float64(mu.Used))+" / "+units.Bytes(float64(mu.Total))) + "\n"
+	}
+	if picked > 0 {
+		percent := float64(used) / float64(total) * 100
+		label := fmt.Sprintf("%-17s", fmt.Sprintf("Combined (%d):", picked))
+		s += fmt.Sprintf("\n %s%s %.1f%% (%s / %s)\n", label, ui.PatternBar(percent, 100, barWidth, diskBarStyle, diskFill),
+			percent, units.Bytes(float64(used)), units.Bytes(float64(total)))
+	} else {
+		s += mutedStyle.Render("   ↑↓ to move, Enter to pick mounts to combine") + "\n"
+	}
+	return s + "\n"
 }
 
 // Define a message type for our timer tick
-type tickMsg time.Time
+type tickMsg struct {
+	at  time.Time
+	gen int
+}
 
-// tick creates a command that will send a tick message after a short delay
-func tick() tea.Cmd {
-	return tea.Tick(time.Second, func(t time.Time) tea.Msg {
-		return tickMsg(t)
+// tick creates a command that will send a tick message after interval
+func tick(gen int, interval time.Duration) tea.Cmd {
+	return tea.Tick(interval, func(t time.Time) tea.Msg {
+		return tickMsg{at: t, gen: gen}
 	})
 }
 
 func main() {
-	p := tea.NewProgram(
-		Model{},
-		tea.WithAltScreen(),
-	)
+	flag.Parse()
+
+	if *versionFlag {
+		fmt.Println(version.String("sys-monitor"))
+		return
+	}
+
+	palette, warnings := theme.Load(*themeFlag)
+	for _, w := range warnings {
+		fmt.Fprintln(os.Stderr, w)
+	}
+	palette, err := theme.Override(palette, *paletteFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(2)
+	}
+	if ui.BasicColors() {
+		palette = palette.Basic()
+	}
+	applyTheme(palette)
+	if theme.NoColor() {
+		// Without colour the bars would be blank, so draw them in ASCII.
+		ui.Plain()
+		applyASCII()
+	} else if *asciiFlag {
+		applyASCII()
+	}
+
+	visible, err := parsePanels(*panelsFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: -panels:", err)
+		os.Exit(2)
+	}
+	panelsSet := false
+	flag.Visit(func(f *flag.Flag) { panelsSet = panelsSet || f.Name == "panels" })
+	var saved savedPanels
+	if !panelsSet && state.Load(panelsStateName, &saved) == nil {
+		if v, err := parsePanels(strings.Join(saved.Panels, ",")); err == nil {
+			visible = v
+		}
+	}
+
+	if *cpuHistoryFlag < 2 {
+		fmt.Fprintln(os.Stderr, "Error: -cpu-history must be at least 2")
+		os.Exit(2)
+	}
+	if *intervalFlag <= 0 {
+		fmt.Fprintln(os.Stderr, "-interval must be positive")
+		os.Exit(2)
+	}
+	if *diskCriticalFlag <= 0 || *diskCriticalFlag > 100 {
+		fmt.Fprintln(os.Stderr, "Error: -disk-critical must be above 0 and at most 100")
+		os.Exit(2)
+	}
+	if *cpuAlertFlag <= 0 || *cpuAlertFlag > 100 || *memAlertFlag <= 0 || *memAlertFlag > 100 {
+		fmt.Fprintln(os.Stderr, "Error: -cpu-alert and -mem-alert must be above 0 and at most 100")
+		os.Exit(2)
+	}
+	if *cpuSampleFlag < 0 {
+		fmt.Fprintln(os.Stderr, "-cpu-sample must not be negative")
+		os.Exit(2)
+	}
+
+	mount, note, err := resolveDisk(*diskFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: -disk:", err)
+		os.Exit(1)
+	}
+	*diskFlag, diskNote = mount, note
+
+	if !*onceFlag && !term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Fprintln(os.Stderr, "sys-monitor: stdout is not a terminal; printing one sample as with -once")
+		*onceFlag = true
+	}
+	if *onceFlag {
+		if diskNote != "" {
+			fmt.Fprintln(os.Stderr, "sys-monitor:", diskNote)
+		}
+		if err := printOnce(*jsonFlag); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	model := Model{procDesc: true, alerts: newAlerts(), pacer: &pace.Pacer{Min: *intervalFlag, Max: max(*maxInterval, *intervalFlag), IdleAfter: idleAfter}}
+	model.setPanels(visible)
+	if *httpFlag != "" {
+		stop, err := startHTTP(*httpFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: -http:", err)
+			os.Exit(1)
+		}
+		defer stop()
+	}
+
+	var opts []tea.ProgramOption
+	if !*inlineFlag {
+		opts = append(opts, tea.WithAltScreen())
+	}
+	p := tea.NewProgram(model, opts...)
 
 	if _, err := p.Run(); err != nil {
 		fmt.Println("Error running program:", err)
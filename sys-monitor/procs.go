@@ -0,0 +1,161 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"clifs/shared/rate"
+	"clifs/shared/units"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// procRows is how many processes the panel lists.
+const procRows = 10
+
+// procSort is what the process panel is ordered by.
+type procSort int
+
+const (
+	sortCPU procSort = iota
+	sortMem
+	sortPID
+	numSorts
+)
+
+func (s procSort) String() string {
+	return [...]string{"CPU", "MEM", "PID"}[s]
+}
+
+// descending is the order each sort key starts in: the biggest users
+// first, but PIDs from the lowest.
+func (s procSort) descending() bool {
+	return s != sortPID
+}
+
+// procInfo is one process as listed in the panel.
+type procInfo struct {
+	PID  int32
+	Name string
+	RSS  uint64  // resident memory, bytes
+	CPU  float64 // percent of one core since the previous reading
+	cpu  uint64  // user and system time, milliseconds, for the next rate
+}
+
+// procsMsg is the result of reading the process list.
+type procsMsg struct {
+	at    time.Time
+	procs []procInfo
+	err   error
+}
+
+// readProcs lists the running processes. Processes that exit or cannot be
+// inspected while the list is read are left out.
+func readProcs() tea.Msg {
+	ps, err := process.Processes()
+	if err != nil {
+		return procsMsg{at: time.Now(), err: err}
+	}
+	procs := make([]procInfo, 0, len(ps))
+	for _, p := range ps {
+		name, err := p.Name()
+		if err != nil {
+			continue
+		}
+		info := procInfo{PID: p.Pid, Name: name}
+		if mem, err := p.MemoryInfo(); err == nil {
+			info.RSS = mem.RSS
+		}
+		if t, err := p.Times(); err == nil {
+			info.cpu = uint64((t.User + t.System) * 1000)
+		}
+		procs = append(procs, info)
+	}
+	return procsMsg{at: time.Now(), procs: procs}
+}
+
+// setProcs takes in a fresh process list, working out CPU usage from the
+// change in each process's CPU time, and sorts it.
+func (m *Model) setProcs(msg procsMsg) {
+	if m.procCPU == nil {
+		m.procCPU = &rate.Tracker{}
+	}
+	readings := make(map[string][]uint64, len(msg.procs))
+	for _, p := range msg.procs {
+		readings[strconv.Itoa(int(p.PID))] = []uint64{p.cpu}
+	}
+	rates := m.procCPU.Update(msg.at, readings)
+	for i := range msg.procs {
+		if r, ok := rates[strconv.Itoa(int(msg.procs[i].PID))]; ok {
+			msg.procs[i].CPU = r[0] / 10 // milliseconds per second to percent
+		}
+	}
+	m.procs = msg.procs
+	m.sortProcs()
+}
+
+// sortProcs orders the cached process list by the current sort key, so
+// changing the key does not wait for the next reading.
+func (m *Model) sortProcs() {
+	procs := slices.Clone(m.procs)
+	slices.SortStableFunc(procs, func(a, b procInfo) int {
+		var c int
+		switch m.procSort {
+		case sortCPU:
+			c = cmp.Compare(a.CPU, b.CPU)
+		case sortMem:
+			c = cmp.Compare(a.RSS, b.RSS)
+		}
+		if c == 0 {
+			c = cmp.Compare(a.PID, b.PID)
+		}
+		if m.procDesc {
+			c = -c
+		}
+		return c
+	})
+	m.procs = procs
+}
+
+// procsView renders the top processes when the panel is enabled, with the
+// sort key and direction in the header.
+func (m Model) procsView() string {
+	if !m.showProcs {
+		return ""
+	}
+	arrow := "↑"
+	if m.procDesc {
+		arrow = "↓"
+	}
+	header := fmt.Sprintf(" Processes:       top by %s %s%s", m.procSort, arrow, m.spinner(loadProcs))
+	if m.procs == nil {
+		return header + "\n\n"
+	}
+
+	pidCol := lipgloss.NewStyle().Width(8).Align(lipgloss.Right)
+	nameCol := lipgloss.NewStyle().Width(20)
+	numCol := lipgloss.NewStyle().Width(10).Align(lipgloss.Right)
+	row := func(pid, name, cpu, mem string) string {
+		return "  " + lipgloss.JoinHorizontal(lipgloss.Top,
+			pidCol.Render(pid), "  ", nameCol.Render(name), numCol.Render(cpu), numCol.Render(mem))
+	}
+	s := header + "\n" + infoStyle.Render(row("PID", "Name", "CPU", "MEM")) + "\n"
+	for _, p := range m.procs[:min(procRows, len(m.procs))] {
+		s += row(strconv.Itoa(int(p.PID)), truncate(p.Name, 19), fmt.Sprintf("%.1f%%", p.CPU), units.Bytes(float64(p.RSS))) + "\n"
+	}
+	return s + mutedStyle.Render("   s to change the sort key, S to reverse it") + "\n\n"
+}
+
+// truncate shortens s to at most n runes, marking the cut with an ellipsis.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// promWrittenMsg reports the outcome of writing the -prom-file.
+type promWrittenMsg struct{ err error }
+
+// promLabel escapes a Prometheus label value.
+var promLabel = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// promMetrics renders the latest readings in the Prometheus text
+// exposition format, as read by node_exporter's textfile collector.
+// Readings that have not arrived yet are left out rather than reported as
+// zero.
+func (m Model) promMetrics() string {
+	var b strings.Builder
+	gauge := func(name, help, labels string, value float64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s%s %g\n", name, help, name, name, labels, value)
+	}
+	if m.hasCPU {
+		gauge("clifs_cpu_usage_percent", "CPU usage across all cores.", "", m.cpuUsage)
+	}
+	if m.memoryTotal > 0 {
+		gauge("clifs_memory_usage_percent", "Memory in use.", "", m.memoryUsage)
+		gauge("clifs_memory_total_bytes", "Total memory.", "", float64(m.memoryTotal))
+	}
+	if m.hasSwap {
+		gauge("clifs_swap_usage_percent", "Swap in use.", "", m.swapUsage)
+		gauge("clifs_swap_total_bytes", "Total swap.", "", float64(m.swapTotal))
+	}
+	if m.diskTotal > 0 {
+		path := `{path="` + promLabel.Replace(*diskFlag) + `"}`
+		gauge("clifs_disk_usage_percent", "Disk space in use on the -disk filesystem.", path, m.diskUsage)
+		gauge("clifs_disk_total_bytes", "Size of the -disk filesystem.", path, float64(m.diskTotal))
+	}
+	if m.diskRates != nil {
+		var read, write float64
+		for _, r := range m.diskRates {
+			read += r[0]
+			write += r[1]
+		}
+		gauge("clifs_disk_read_bytes_per_second", "Bytes read per second, all physical disks.", "", read)
+		gauge("clifs_disk_written_bytes_per_second", "Bytes written per second, all physical disks.", "", write)
+	}
+	if m.netRates != nil {
+		gauge("clifs_network_sent_bytes_per_second", "Bytes sent per second, all interfaces.", "", m.netRates[0])
+		gauge("clifs_network_received_bytes_per_second", "Bytes received per second, all interfaces.", "", m.netRates[1])
+	}
+	return b.String()
+}
+
+// exportProm writes the metrics to the -prom-file, if one was given.
+func (m Model) exportProm() tea.Cmd {
+	if *promFileFlag == "" {
+		return nil
+	}
+	path, metrics := *promFileFlag, m.promMetrics()
+	return func() tea.Msg {
+		return promWrittenMsg{writeFileAtomic(path, metrics)}
+	}
+}
+
+// writeFileAtomic replaces path with data through a temporary file in the
+// same directory and a rename, so a reader never sees it half written.
+func writeFileAtomic(path, data string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly once renamed
+	if _, err := tmp.WriteString(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// CreateTemp makes the file private; the collector may run as another
+	// user.
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}